@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	passwordResetTTL = 45 * time.Minute
+	emailChangeTTL   = 24 * time.Hour
+)
+
+// passwordResetHandler handles the display of the password reset form.
+func (app *application) passwordResetHandler(c echo.Context) error {
+	return c.Render(http.StatusOK, "password_reset.tmpl.html", app.newTemplateData(c))
+}
+
+// passwordResetHandlerPost sends a password reset link. The response is the
+// same whether the account exists or not, so it can't be used to probe for
+// email addresses.
+func (app *application) passwordResetHandlerPost(c echo.Context) error {
+	req := model.PasswordResetRequest{Email: c.FormValue("email")}
+	if err := c.Validate(&req); err != nil {
+		return app.renderFormErrors(c, "password_reset.tmpl.html", req, err)
+	}
+
+	app.requestPasswordReset(req.Email)
+
+	app.sessionManager.Put(c.Request().Context(), "flash", "If an account exists for this email address, we have sent you a link to reset your password.")
+	return c.Render(http.StatusOK, "home.tmpl.html", app.newTemplateData(c))
+}
+
+// passwordResetHandlerJsonPost sends a password reset link with json.
+func (app *application) passwordResetHandlerJsonPost(c echo.Context) error {
+	var body model.PasswordResetRequest
+	if err := bind(c, &body); err != nil {
+		return err
+	}
+
+	app.requestPasswordReset(body.Email)
+
+	return c.JSON(http.StatusAccepted, "If an account exists for this email address, we have sent you a link to reset your password.")
+}
+
+func (app *application) requestPasswordReset(email string) {
+	user, err := app.models.Users.GetByEmail(email)
+	if err != nil {
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, passwordResetTTL, model.ScopePasswordReset)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	sendPasswordResetEmail(token, user, app)
+}
+
+// newPasswordForm holds the values of the form to choose a new password.
+type newPasswordForm struct {
+	Token           string `json:"token" validate:"required"`
+	Password        string `json:"password" validate:"required,min=8,max=72"`
+	PasswordConfirm string `json:"password_confirm" validate:"required,eqfield=Password"`
+}
+
+// newPasswordHandler handles the display of the form to choose a new password.
+func (app *application) newPasswordHandler(c echo.Context) error {
+	token := c.QueryParam("token")
+	err := model.ValidateTokenPlaintext(token)
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Invalid token or token expired.")
+		return c.Render(http.StatusBadRequest, "home.tmpl.html", app.newTemplateData(c))
+	}
+
+	data := app.newTemplateData(c)
+	data.Form = newPasswordForm{Token: token}
+	return c.Render(http.StatusOK, "password_new.tmpl.html", data)
+}
+
+// newPasswordHandlerPost sets a new password using a password reset token.
+func (app *application) newPasswordHandlerPost(c echo.Context) error {
+	req := newPasswordForm{
+		Token:           c.FormValue("token"),
+		Password:        c.FormValue("password"),
+		PasswordConfirm: c.FormValue("password_confirm"),
+	}
+	if err := c.Validate(&req); err != nil {
+		return app.renderFormErrors(c, "password_new.tmpl.html", newPasswordForm{Token: req.Token}, err)
+	}
+
+	err := app.resetPassword(req.Token, req.Password)
+	if err != nil {
+		if !errors.Is(err, model.ErrValidation) {
+			return err
+		}
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Invalid token or token expired.")
+		return c.Render(http.StatusBadRequest, "home.tmpl.html", app.newTemplateData(c))
+	}
+
+	app.sessionManager.Put(c.Request().Context(), "flash", "Your password has been changed. Please log in.")
+	return c.Redirect(http.StatusSeeOther, "/login")
+}
+
+// newPasswordHandlerJsonPut sets a new password using a password reset token with json.
+func (app *application) newPasswordHandlerJsonPut(c echo.Context) error {
+	var body model.PasswordUpdateRequest
+	if err := bind(c, &body); err != nil {
+		return err
+	}
+
+	err := app.resetPassword(body.Token, body.Password)
+	if err != nil {
+		if !errors.Is(err, model.ErrValidation) {
+			return err
+		}
+		return jsonError(c, http.StatusBadRequest, "invalid token or token expired")
+	}
+
+	return c.JSON(http.StatusOK, "Your password has been changed. Please log in.")
+}
+
+// resetPassword sets the password of the user the reset token belongs to
+// and invalidates all outstanding reset tokens of that user.
+func (app *application) resetPassword(token, password string) error {
+	err := model.ValidateTokenPlaintext(token)
+	if err != nil {
+		return err
+	}
+
+	userID, err := app.models.Tokens.GetUserID(model.ScopePasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Users.SetPassword(userID, password)
+	if err != nil {
+		return err
+	}
+
+	return app.models.Tokens.DeleteAllForUser(model.ScopePasswordReset, userID)
+}
+
+// changeEmailHandlerJsonPost starts an email address change. The new address
+// has to be confirmed with the link sent to it.
+func (app *application) changeEmailHandlerJsonPost(c echo.Context) error {
+	var body model.EmailChangeRequest
+	if err := bind(c, &body); err != nil {
+		return err
+	}
+
+	user, err := app.userFromContext(c)
+	if err != nil {
+		return jsonError(c, http.StatusUnauthorized, "Unauthorized")
+	}
+
+	err = app.models.Users.SetPendingEmail(user, body.Email)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.models.Tokens.New(user.ID, emailChangeTTL, model.ScopeEmailChange)
+	if err != nil {
+		return err
+	}
+	sendEmailChangeEmail(token, user, app)
+
+	return c.JSON(http.StatusAccepted, "Please check the mailbox of your new email address for the confirmation link.")
+}
+
+// confirmEmailHandler completes an email address change.
+func (app *application) confirmEmailHandler(c echo.Context) error {
+	token := c.QueryParam("token")
+
+	renderError := func() error {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Invalid token or token expired.")
+		return c.Render(http.StatusBadRequest, "home.tmpl.html", app.newTemplateData(c))
+	}
+
+	err := model.ValidateTokenPlaintext(token)
+	if err != nil {
+		return renderError()
+	}
+
+	userID, err := app.models.Tokens.GetUserID(model.ScopeEmailChange, token)
+	if err != nil {
+		return renderError()
+	}
+
+	_, err = app.models.Users.ConfirmEmail(userID)
+	if err != nil {
+		return renderError()
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(model.ScopeEmailChange, userID)
+	if err != nil {
+		log.Error(err)
+	}
+
+	app.sessionManager.Put(c.Request().Context(), "flash", "Your email address has been changed.")
+	return c.Render(http.StatusOK, "home.tmpl.html", app.newTemplateData(c))
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+// apiV1Prefix is the path of the versioned api.
+const apiV1Prefix = "/api/v1"
+
+// Error codes of the json api.
+const (
+	codeBadRequest   = "bad_request"
+	codeUnauthorized = "unauthorized"
+	codeForbidden    = "forbidden"
+	codeNotFound     = "not_found"
+	codeMethod       = "method_not_allowed"
+	codeConflict     = "conflict"
+	codeRateLimited  = "rate_limited"
+	codeInternal     = "internal_error"
+)
+
+// apiError is the error envelope of the versioned api.
+type apiError struct {
+	Error apiErrorBody `json:"error"`
+}
+
+type apiErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Fields are the validation errors by field name.
+	Fields model.FieldErrors `json:"fields,omitempty"`
+	// Existing is the link the user already has for a url they shorten again.
+	Existing *model.UrlResponse `json:"existing,omitempty"`
+}
+
+// isV1 reports whether a request is for the versioned api.
+func isV1(c echo.Context) bool {
+	return strings.HasPrefix(c.Request().URL.Path, apiV1Prefix+"/")
+}
+
+// jsonError sends an error with the code matching the status. See jsonErrorCode.
+func jsonError(c echo.Context, status int, message string) error {
+	return jsonErrorCode(c, status, errorCode(status), message)
+}
+
+// jsonErrorCode sends an error in the error envelope on the versioned api.
+// The unversioned api keeps sending the bare message, as older clients expect.
+func jsonErrorCode(c echo.Context, status int, code, message string) error {
+	if !isV1(c) {
+		return c.JSON(status, message)
+	}
+	return c.JSON(status, apiError{Error: apiErrorBody{Code: code, Message: message}})
+}
+
+// errorCode returns the error code of a status.
+func errorCode(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusMethodNotAllowed:
+		return codeMethod
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusTooManyRequests:
+		return codeRateLimited
+	}
+	if status >= 500 {
+		return codeInternal
+	}
+	return codeBadRequest
+}
+
+// httpErrorHandler handles the errors returned by handlers. Model errors
+// get the status of their kind, anything unexpected is logged and sent as a
+// 500 without details. API requests get json, browsers an error page.
+func (app *application) httpErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status, message := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+
+	switch {
+	case c.Request().Method == http.MethodHead:
+		err = c.NoContent(status)
+	case wantsJSON(c):
+		var fields model.FieldErrors
+		if errors.As(err, &fields) && isV1(c) {
+			err = c.JSON(status, apiError{Error: apiErrorBody{Code: errorCode(status), Message: message, Fields: fields}})
+		} else {
+			err = jsonError(c, status, message)
+		}
+	default:
+		data := app.newTemplateData(c)
+		data.Error = &pageError{Status: status, Title: http.StatusText(status), Message: message}
+		err = c.Render(status, "error.tmpl.html", data)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+// errorStatus returns the status and the message to send for an error.
+func errorStatus(err error) (int, string) {
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return he.Code, fmt.Sprint(he.Message)
+	}
+
+	switch {
+	case errors.Is(err, model.ErrNotFound):
+		return http.StatusNotFound, err.Error()
+	case errors.Is(err, model.ErrConflict):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, model.ErrValidation):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, model.ErrForbidden):
+		return http.StatusForbidden, err.Error()
+	case errors.Is(err, model.ErrInvalidCredentials), errors.Is(err, model.ErrNoUser):
+		return http.StatusUnauthorized, err.Error()
+	}
+	return http.StatusInternalServerError, "internal server error"
+}
+
+// wantsJSON reports whether an error should be sent as json.
+func wantsJSON(c echo.Context) bool {
+	req := c.Request()
+	return strings.HasPrefix(req.URL.Path, "/api/") ||
+		strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) ||
+		strings.Contains(req.Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON)
+}
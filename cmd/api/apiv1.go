@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/bueti/shrinkster/internal/authz"
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+// apiRoute is an endpoint of the versioned api. The route table registers
+// the handlers and is the source of the OpenAPI document, so the two can't
+// drift apart.
+type apiRoute struct {
+	Method string
+	// Path is relative to apiV1Prefix, with echo style parameters.
+	Path       string
+	Handler    echo.HandlerFunc
+	Middleware []echo.MiddlewareFunc
+
+	Summary string
+	Tag     string
+	// Auth routes require a bearer token, Admin routes additionally the admin role.
+	Auth  bool
+	Admin bool
+	// Resource is loaded before the handler runs, the user needs the
+	// permission Action on it.
+	Resource resource
+	Action   authz.Action
+	Params   []apiParam
+	// Request is a value of the type of the json body, nil if there is none.
+	Request any
+	Status  int
+	// Response is a value of the type of the response body, nil if there is none.
+	Response any
+}
+
+// apiParam documents a path or query parameter.
+type apiParam struct {
+	Name        string
+	In          string
+	Type        string
+	Format      string
+	Description string
+}
+
+var (
+	pageParams = []apiParam{
+		{Name: "page", In: "query", Type: "integer", Description: "Page to return, starting at 1."},
+		{Name: "page_size", In: "query", Type: "integer", Description: "Number of items per page, at most 500."},
+	}
+	urlIDParam  = apiParam{Name: "id", In: "path", Type: "string", Description: "Id or short code of the url."}
+	userIDParam = func(name string) apiParam {
+		return apiParam{Name: name, In: "path", Type: "string", Format: "uuid", Description: "Id of the user."}
+	}
+)
+
+// textResponse is the type of responses consisting of a message only.
+const textResponse = ""
+
+// apiV1Routes returns the endpoints of the versioned api.
+func (app *application) apiV1Routes() []apiRoute {
+	authLimit := app.rateLimit(app.config.rateLimit.auth)
+	linksLimit := app.rateLimit(app.config.rateLimit.links)
+
+	return []apiRoute{
+		{
+			Method: http.MethodGet, Path: "/health", Handler: app.healthcheckHandlerJson,
+			Summary: "Check the health of the service", Tag: "meta",
+			Status: http.StatusOK, Response: map[string]string{},
+		},
+		{
+			Method: http.MethodGet, Path: "/openapi.json", Handler: app.openAPIHandlerJson,
+			Summary: "Get this OpenAPI document", Tag: "meta",
+			Status: http.StatusOK, Response: map[string]any{},
+		},
+
+		// authentication
+		{
+			Method: http.MethodPost, Path: "/signup", Handler: app.signupHandlerJsonPost, Middleware: []echo.MiddlewareFunc{authLimit},
+			Summary: "Create an account", Tag: "auth",
+			Request: model.UserRegisterReq{}, Status: http.StatusCreated, Response: model.UserResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/login", Handler: app.loginHandlerJsonPost, Middleware: []echo.MiddlewareFunc{authLimit},
+			Summary: "Log in and get a bearer token", Tag: "auth",
+			Request: model.UserLoginRequest{}, Status: http.StatusOK, Response: model.UserLoginResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/device/code", Handler: app.deviceCodeHandlerJsonPost, Middleware: []echo.MiddlewareFunc{authLimit},
+			Summary: "Start a device authorization", Tag: "auth",
+			Status: http.StatusOK, Response: model.DeviceCodeResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/device/token", Handler: app.deviceTokenHandlerJsonPost,
+			Summary: "Poll for the token of a device authorization", Tag: "auth",
+			Request: model.DeviceTokenRequest{}, Status: http.StatusOK, Response: model.UserLoginResponse{},
+		},
+
+		// account
+		{
+			Method: http.MethodPost, Path: "/users/activate", Handler: app.activateUserHandlerJson,
+			Summary: "Activate an account with the token from the activation email", Tag: "account",
+			Request: activationRequest{}, Status: http.StatusOK, Response: textResponse,
+		},
+		{
+			Method: http.MethodPost, Path: "/users/resend-activation", Handler: app.resendActivationLinkHandlerJsonPost, Middleware: []echo.MiddlewareFunc{authLimit},
+			Summary: "Send the activation email again", Tag: "account",
+			Request: model.PasswordResetRequest{}, Status: http.StatusOK, Response: textResponse,
+		},
+		{
+			Method: http.MethodPost, Path: "/users/password-reset", Handler: app.passwordResetHandlerJsonPost, Middleware: []echo.MiddlewareFunc{authLimit},
+			Summary: "Send a password reset email", Tag: "account",
+			Request: model.PasswordResetRequest{}, Status: http.StatusAccepted, Response: textResponse,
+		},
+		{
+			Method: http.MethodPut, Path: "/users/password", Handler: app.newPasswordHandlerJsonPut, Middleware: []echo.MiddlewareFunc{authLimit},
+			Summary: "Set a new password with the token from the password reset email", Tag: "account",
+			Request: model.PasswordUpdateRequest{}, Status: http.StatusOK, Response: textResponse,
+		},
+		{
+			Method: http.MethodGet, Path: "/me", Handler: app.meHandlerJson, Auth: true,
+			Summary: "Get the authenticated user", Tag: "account",
+			Status: http.StatusOK, Response: model.UserResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/me/email", Handler: app.changeEmailHandlerJsonPost, Auth: true,
+			Summary: "Change the email address, it has to be confirmed with the link sent to it", Tag: "account",
+			Request: model.EmailChangeRequest{}, Status: http.StatusAccepted, Response: textResponse,
+		},
+		{
+			Method: http.MethodGet, Path: "/me/urls", Handler: app.myUrlsHandlerJson, Auth: true,
+			Summary: "List your urls, the total is in X-Total-Count and the next page in the Link header", Tag: "urls",
+			Params: pageParams, Status: http.StatusOK, Response: []model.UrlByUserResponse{},
+		},
+		{
+			Method: http.MethodPut, Path: "/me/preferences", Handler: app.preferencesHandlerJsonPut, Auth: true,
+			Summary: "Change the settings", Tag: "account",
+			Request: model.PreferencesRequest{}, Status: http.StatusOK, Response: model.PreferencesRequest{},
+		},
+
+		// users
+		{
+			Method: http.MethodGet, Path: "/users", Handler: app.listUsersHandlerJson, Auth: true, Admin: true,
+			Summary: "List all users", Tag: "users",
+			Status: http.StatusOK, Response: []model.UserResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/users/:id", Handler: app.getUserHandlerJson, Auth: true, Resource: app.userResource("id"), Action: authz.Read,
+			Summary: "Get a user", Tag: "users",
+			Params: []apiParam{userIDParam("id")}, Status: http.StatusOK, Response: model.UserResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/users/:id/unlock", Handler: app.unlockUserHandlerJsonPost, Auth: true, Admin: true,
+			Summary: "Unlock a locked account", Tag: "users",
+			Params: []apiParam{userIDParam("id")}, Status: http.StatusOK, Response: textResponse,
+		},
+		{
+			Method: http.MethodGet, Path: "/users/:user_id/urls", Handler: app.getUrlByUserHandlerJson, Auth: true, Resource: app.userResource("user_id"), Action: authz.Read,
+			Summary: "List the urls of a user, the total is in X-Total-Count and the next page in the Link header", Tag: "urls",
+			Params: append([]apiParam{userIDParam("user_id")}, pageParams...), Status: http.StatusOK, Response: []model.UrlByUserResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/users/:user_id/urls", Handler: app.createUrlForUserHandlerJsonPost, Auth: true, Admin: true,
+			Summary: "Shorten an url on behalf of a user", Tag: "urls",
+			Params: []apiParam{userIDParam("user_id")}, Request: model.UrlCreateRequest{}, Status: http.StatusCreated, Response: model.UrlResponse{},
+		},
+
+		// urls
+		{
+			Method: http.MethodPost, Path: "/urls", Handler: app.createUrlHandlerJsonPost, Middleware: []echo.MiddlewareFunc{linksLimit}, Auth: true,
+			Summary: "Shorten an url, it belongs to the authenticated user", Tag: "urls",
+			Request: model.UrlCreateRequest{}, Status: http.StatusCreated, Response: model.UrlResponse{},
+		},
+		{
+			Method: http.MethodGet, Path: "/urls/:id", Handler: app.getUrlByCodeHandlerJson, Auth: true, Resource: app.urlResource(), Action: authz.Read,
+			Summary: "Get an url and its recent clicks", Tag: "urls",
+			Params: []apiParam{urlIDParam}, Status: http.StatusOK, Response: model.UrlInfoResponse{},
+		},
+		{
+			Method: http.MethodPut, Path: "/urls/:id", Handler: app.updateUrlHandlerJsonPut, Auth: true, Resource: app.urlResource(), Action: authz.Update,
+			Summary: "Change the destination and expiry of an url", Tag: "urls",
+			Params: []apiParam{urlIDParam}, Request: model.UrlUpdateRequest{}, Status: http.StatusOK, Response: model.UrlResponse{},
+		},
+		{
+			Method: http.MethodDelete, Path: "/urls/:id", Handler: app.deleteUrlHandlerJson, Auth: true, Resource: app.urlResource(), Action: authz.Delete,
+			Summary: "Delete an url", Tag: "urls",
+			Params: []apiParam{urlIDParam}, Status: http.StatusNoContent,
+		},
+		{
+			Method: http.MethodGet, Path: "/urls/:id/stats", Handler: app.urlStatsHandlerJson, Auth: true, Resource: app.urlResource(), Action: authz.Read,
+			Summary: "Get the clicks of an url over time and its top referrers, countries and devices", Tag: "urls",
+			Params: []apiParam{
+				urlIDParam,
+				{Name: "since", In: "query", Type: "string", Description: "Start of the period, a date or RFC 3339 timestamp. Defaults to 30 days before until."},
+				{Name: "until", In: "query", Type: "string", Description: "End of the period, a date or RFC 3339 timestamp. Defaults to now."},
+				{Name: "interval", In: "query", Type: "string", Description: "Size of the buckets: hour, day, week or month. Defaults to day."},
+			},
+			Status: http.StatusOK, Response: model.ClickStats{},
+		},
+
+		// domains
+		{
+			Method: http.MethodGet, Path: "/domains", Handler: app.listDomainRulesHandlerJson, Auth: true, Admin: true,
+			Summary: "List the domain allow and block rules", Tag: "domains",
+			Status: http.StatusOK, Response: []model.DomainRule{},
+		},
+		{
+			Method: http.MethodPost, Path: "/domains", Handler: app.createDomainRuleHandlerJsonPost, Auth: true, Admin: true,
+			Summary: "Add a domain rule", Tag: "domains",
+			Request: model.DomainRuleRequest{}, Status: http.StatusCreated, Response: model.DomainRule{},
+		},
+		{
+			Method: http.MethodDelete, Path: "/domains/:id", Handler: app.deleteDomainRuleHandlerJson, Auth: true, Admin: true,
+			Summary: "Remove a domain rule", Tag: "domains",
+			Params: []apiParam{{Name: "id", In: "path", Type: "integer", Description: "Id of the domain rule."}},
+			Status: http.StatusOK, Response: textResponse,
+		},
+	}
+}
+
+// registerAPIv1 registers the routes of the versioned api.
+func (app *application) registerAPIv1() error {
+	routes := app.apiV1Routes()
+	doc, err := newOpenAPI(routes)
+	if err != nil {
+		return fmt.Errorf("generating the openapi document: %w", err)
+	}
+	app.openAPI = doc
+
+	v1 := app.echo.Group(apiV1Prefix)
+	for _, r := range routes {
+		var middleware []echo.MiddlewareFunc
+		if r.Auth {
+			middleware = append(middleware, app.apiAuthenticate)
+		}
+		if r.Admin {
+			middleware = append(middleware, app.requireRole("admin"))
+		}
+		if r.Resource.load != nil {
+			middleware = append(middleware, app.authorize(r.Resource, r.Action))
+		}
+		middleware = append(middleware, r.Middleware...)
+		v1.Add(r.Method, r.Path, r.Handler, middleware...)
+	}
+	return nil
+}
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+// openAPIPath turns an echo path into an OpenAPI path template.
+func openAPIPath(path string) string {
+	return pathParam.ReplaceAllString(path, "{$1}")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	deviceCodeTTL      = 10 * time.Minute
+	devicePollInterval = 5 * time.Second
+)
+
+// deviceHandler handles the display of the device approval form.
+func (app *application) deviceHandler(c echo.Context) error {
+	data := app.newTemplateData(c)
+	data.Form = map[string]string{"user_code": model.NormalizeUserCode(c.QueryParam("user_code"))}
+	return c.Render(http.StatusOK, "device.tmpl.html", data)
+}
+
+// deviceHandlerPost handles the approval or denial of a device by the logged-in user.
+func (app *application) deviceHandlerPost(c echo.Context) error {
+	user, err := app.userFromContext(c)
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Bad Request, are you logged in?")
+		return c.Render(http.StatusBadRequest, "login.tmpl.html", app.newTemplateData(c))
+	}
+
+	device, err := app.models.Devices.GetByUserCode(c.FormValue("user_code"))
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Invalid or expired code.")
+		return c.Render(http.StatusBadRequest, "device.tmpl.html", app.newTemplateData(c))
+	}
+
+	if c.FormValue("action") == "deny" {
+		err = app.models.Devices.Deny(device)
+		if errors.Is(err, model.ErrNotFound) {
+			app.sessionManager.Put(c.Request().Context(), "flash_error", "Invalid or expired code.")
+			return c.Render(http.StatusBadRequest, "device.tmpl.html", app.newTemplateData(c))
+		}
+		if err != nil {
+			app.sessionManager.Put(c.Request().Context(), "flash_error", "Internal Server Error. Please try again later.")
+			return c.Render(http.StatusInternalServerError, "device.tmpl.html", app.newTemplateData(c))
+		}
+		app.sessionManager.Put(c.Request().Context(), "flash", "The device has been denied access.")
+		return c.Render(http.StatusOK, "home.tmpl.html", app.newTemplateData(c))
+	}
+
+	err = app.models.Devices.Approve(device, user.ID)
+	if errors.Is(err, model.ErrNotFound) {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Invalid or expired code.")
+		return c.Render(http.StatusBadRequest, "device.tmpl.html", app.newTemplateData(c))
+	}
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Internal Server Error. Please try again later.")
+		return c.Render(http.StatusInternalServerError, "device.tmpl.html", app.newTemplateData(c))
+	}
+
+	app.sessionManager.Put(c.Request().Context(), "flash", "Device approved. You can return to your terminal.")
+	return c.Render(http.StatusOK, "home.tmpl.html", app.newTemplateData(c))
+}
+
+// deviceCodeHandlerJsonPost starts a device authorization flow.
+func (app *application) deviceCodeHandlerJsonPost(c echo.Context) error {
+	device, deviceCode, err := app.models.Devices.New(deviceCodeTTL)
+	if err != nil {
+		return err
+	}
+
+	verificationURI := c.Scheme() + "://" + c.Request().Host + "/device"
+	return c.JSON(http.StatusOK, model.DeviceCodeResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                device.UserCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(device.UserCode),
+		ExpiresIn:               int(deviceCodeTTL.Seconds()),
+		Interval:                int(devicePollInterval.Seconds()),
+	})
+}
+
+// deviceErrors are the messages of the RFC 8628 error codes.
+var deviceErrors = map[string]string{
+	"invalid_grant":         "unknown device code",
+	"expired_token":         "the device code has expired",
+	"access_denied":         "the device was denied access",
+	"slow_down":             "polling too fast",
+	"authorization_pending": "waiting for approval",
+}
+
+// deviceError sends an RFC 8628 error code. The versioned api wraps it in
+// the error envelope.
+func deviceError(c echo.Context, code string) error {
+	if !isV1(c) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": code})
+	}
+	return jsonErrorCode(c, http.StatusBadRequest, code, deviceErrors[code])
+}
+
+// deviceTokenHandlerJsonPost is polled by the CLI until the device has been
+// approved. The error codes follow RFC 8628, section 3.5.
+func (app *application) deviceTokenHandlerJsonPost(c echo.Context) error {
+	var body model.DeviceTokenRequest
+	if err := bind(c, &body); err != nil {
+		return err
+	}
+
+	device, err := app.models.Devices.GetByDeviceCode(body.DeviceCode)
+	if errors.Is(err, model.ErrNotFound) {
+		return deviceError(c, "invalid_grant")
+	}
+	if err != nil {
+		return err
+	}
+
+	if time.Now().After(device.Expiry) {
+		_ = app.models.Devices.Delete(device)
+		return deviceError(c, "expired_token")
+	}
+
+	switch device.Status {
+	case model.DeviceStatusDenied:
+		_ = app.models.Devices.Delete(device)
+		return deviceError(c, "access_denied")
+	case model.DeviceStatusPending:
+		tooFast := time.Since(device.LastPolledAt) < devicePollInterval
+		if err := app.models.Devices.Touch(device); err != nil {
+			return err
+		}
+		if tooFast {
+			return deviceError(c, "slow_down")
+		}
+		return deviceError(c, "authorization_pending")
+	}
+
+	// consume the grant before issuing the token, concurrent polls must not
+	// both get one
+	userID, err := app.models.Devices.Consume(device)
+	if errors.Is(err, model.ErrNotFound) {
+		return deviceError(c, "invalid_grant")
+	}
+	if err != nil {
+		return err
+	}
+
+	user, err := app.models.Users.GetByID(userID)
+	if err != nil {
+		return deviceError(c, "invalid_grant")
+	}
+
+	token, err := app.newAuthToken(user)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, model.UserLoginResponse{
+		ID:    user.ID,
+		Email: user.Email,
+		Token: token,
+	})
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/pascaldekloe/jwt"
+)
+
+const (
+	// digestInterval is how often the scheduler looks for due digests.
+	digestInterval  = time.Hour
+	digestMaxLinks  = 20
+	digestTopMovers = 3
+	// unsubscribeAudience keeps unsubscribe tokens from being accepted as auth tokens.
+	unsubscribeAudience = "shrink.ch/unsubscribe"
+)
+
+type settingsForm struct {
+	DigestFrequency string
+	Frequencies     []string
+}
+
+// digestLink is a link in the digest email. The json tags are the names
+// used in the template, since the data goes through the outbox as json.
+type digestLink struct {
+	ShortUrl string `json:"shortUrl"`
+	Original string `json:"original"`
+	Clicks   int    `json:"clicks"`
+	Change   string `json:"change,omitempty"`
+	delta    int
+}
+
+// runDigests sends the digest emails which are due until ctx is cancelled.
+func (app *application) runDigests(ctx context.Context) {
+	ticker := time.NewTicker(digestInterval)
+	defer ticker.Stop()
+
+	for {
+		app.sendDigests(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) sendDigests(now time.Time) {
+	users, err := app.models.Users.DueForDigest(now)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	for i := range users {
+		user := &users[i]
+		// claim the digest first, other instances may be sending it too
+		claimed, err := app.models.Users.ClaimDigest(user, now)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		data, err := app.digestData(user, now)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		// users without any links get no email, but are still marked as done
+		if data != nil {
+			app.enqueueEmail(user.Email, "weekly_stats.tmpl.html", data)
+		}
+	}
+}
+
+// digestData summarizes the clicks of a user's links in the digest period,
+// compared to the period before.
+func (app *application) digestData(user *model.User, now time.Time) (map[string]any, error) {
+	urls, err := app.models.Urls.GetUrlByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(*urls) == 0 {
+		return nil, nil
+	}
+
+	from := model.DigestPeriod(user.DigestFrequency, now)
+	previous := model.DigestPeriod(user.DigestFrequency, from)
+	current, err := app.models.Clicks.CountByUrl(user.ID, from, now)
+	if err != nil {
+		return nil, err
+	}
+	before, err := app.models.Clicks.CountByUrl(user.ID, previous, from)
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+	var links []digestLink
+	for _, u := range *urls {
+		clicks := current[u.ID]
+		total += clicks
+		links = append(links, digestLink{
+			ShortUrl: genFullUrl(app.baseURL(), u.ShortUrl),
+			Original: u.Original,
+			Clicks:   clicks,
+			delta:    clicks - before[u.ID],
+		})
+	}
+
+	sort.SliceStable(links, func(i, j int) bool { return links[i].Clicks > links[j].Clicks })
+
+	var movers []digestLink
+	for _, link := range links {
+		if link.delta > 0 {
+			link.Change = fmt.Sprintf("up %d", link.delta)
+			movers = append(movers, link)
+		}
+	}
+	sort.SliceStable(movers, func(i, j int) bool { return movers[i].delta > movers[j].delta })
+	if len(movers) > digestTopMovers {
+		movers = movers[:digestTopMovers]
+	}
+	if len(links) > digestMaxLinks {
+		links = links[:digestMaxLinks]
+	}
+
+	expiredUrls, err := app.models.Urls.ExpiredBetween(user.ID, from, now)
+	if err != nil {
+		return nil, err
+	}
+	var expired []digestLink
+	for _, u := range expiredUrls {
+		expired = append(expired, digestLink{ShortUrl: genFullUrl(app.baseURL(), u.ShortUrl), Original: u.Original})
+	}
+
+	unsubscribeToken, err := app.newUnsubscribeToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	period := "in the last week"
+	if user.DigestFrequency == model.DigestMonthly {
+		period = "in the last month"
+	}
+
+	return map[string]any{
+		"name":           user.Name,
+		"period":         period,
+		"totalClicks":    total,
+		"links":          links,
+		"topMovers":      movers,
+		"expired":        expired,
+		"unsubscribeUrl": app.baseURL() + "/users/unsubscribe?token=" + url.QueryEscape(unsubscribeToken),
+	}, nil
+}
+
+// newUnsubscribeToken issues a signed token which turns off the digest of a
+// user. It doesn't expire, so the links in old emails keep working.
+func (app *application) newUnsubscribeToken(user *model.User) (string, error) {
+	var claims jwt.Claims
+	claims.Subject = user.ID.String()
+	claims.Issued = jwt.NewNumericTime(time.Now())
+	claims.Issuer = "shrink.ch"
+	claims.Audiences = []string{unsubscribeAudience}
+
+	jwtBytes, err := claims.HMACSign(jwt.HS256, []byte(app.config.signingKey))
+	if err != nil {
+		return "", err
+	}
+	return string(jwtBytes), nil
+}
+
+// unsubscribeHandler turns off the digest emails for the user of the token.
+func (app *application) unsubscribeHandler(c echo.Context) error {
+	renderError := func() error {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Invalid unsubscribe link.")
+		return c.Render(http.StatusBadRequest, "home.tmpl.html", app.newTemplateData(c))
+	}
+
+	claims, err := jwt.HMACCheck([]byte(c.QueryParam("token")), []byte(app.config.signingKey))
+	if err != nil {
+		return renderError()
+	}
+	if claims.Issuer != "shrink.ch" || !claims.AcceptAudience(unsubscribeAudience) {
+		return renderError()
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return renderError()
+	}
+
+	err = app.models.Users.SetDigestFrequency(userID, model.DigestOff)
+	if err != nil {
+		return renderError()
+	}
+
+	app.sessionManager.Put(c.Request().Context(), "flash", "You have been unsubscribed from the digest emails.")
+	return c.Render(http.StatusOK, "home.tmpl.html", app.newTemplateData(c))
+}
+
+// settingsHandler handles the display of the user settings.
+func (app *application) settingsHandler(c echo.Context) error {
+	user, err := app.userFromContext(c)
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Bad Request, are you logged in?")
+		return c.Render(http.StatusBadRequest, "login.tmpl.html", app.newTemplateData(c))
+	}
+
+	data := app.newTemplateData(c)
+	data.User = user
+	data.Form = settingsForm{DigestFrequency: user.DigestFrequency, Frequencies: model.DigestFrequencies}
+	return c.Render(http.StatusOK, "settings.tmpl.html", data)
+}
+
+// settingsHandlerPost saves the user settings.
+func (app *application) settingsHandlerPost(c echo.Context) error {
+	user, err := app.userFromContext(c)
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Bad Request, are you logged in?")
+		return c.Render(http.StatusBadRequest, "login.tmpl.html", app.newTemplateData(c))
+	}
+
+	err = app.models.Users.SetDigestFrequency(user.ID, c.FormValue("digest_frequency"))
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Failed to save your settings.")
+		return c.Redirect(http.StatusSeeOther, "/settings")
+	}
+
+	app.sessionManager.Put(c.Request().Context(), "flash", "Settings saved.")
+	return c.Redirect(http.StatusSeeOther, "/settings")
+}
+
+// preferencesHandlerJsonPut saves the user settings with json.
+func (app *application) preferencesHandlerJsonPut(c echo.Context) error {
+	var body model.PreferencesRequest
+	if err := bind(c, &body); err != nil {
+		return err
+	}
+
+	user, err := app.userFromContext(c)
+	if err != nil {
+		return jsonError(c, http.StatusUnauthorized, "Unauthorized")
+	}
+
+	err = app.models.Users.SetDigestFrequency(user.ID, body.DigestFrequency)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, body)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+// listDomainRulesHandlerJson lists the allowed and blocked domains.
+func (app *application) listDomainRulesHandlerJson(c echo.Context) error {
+	rules, err := app.models.Domains.List()
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, rules)
+}
+
+// createDomainRuleHandlerJsonPost adds a domain to the allow- or blocklist.
+func (app *application) createDomainRuleHandlerJsonPost(c echo.Context) error {
+	var body model.DomainRuleRequest
+	if err := bind(c, &body); err != nil {
+		return err
+	}
+
+	rule, err := app.models.Domains.Create(&body)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, rule)
+}
+
+// deleteDomainRuleHandlerJson removes a domain from the allow- or blocklist.
+func (app *application) deleteDomainRuleHandlerJson(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	err = app.models.Domains.Delete(uint(id))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, "The domain has been removed.")
+}
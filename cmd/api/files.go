@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bueti/shrinkster/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// filesPrefix is the path below which files of the local and database storage are served.
+const filesPrefix = "/files"
+
+// filesHandler serves files of storage backends which aren't publicly
+// reachable on their own.
+func (app *application) filesHandler(opener storage.Opener) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		obj, err := opener.Open(c.Request().Context(), c.Param("key"))
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+				return c.JSON(http.StatusNotFound, "Not Found")
+			}
+			return c.JSON(http.StatusInternalServerError, "Internal Server Error")
+		}
+		defer obj.Body.Close()
+
+		if obj.ContentType != "" {
+			c.Response().Header().Set(echo.HeaderContentType, obj.ContentType)
+		}
+		c.Response().Header().Set("Cache-Control", "public, max-age=86400")
+		http.ServeContent(c.Response(), c.Request(), c.Param("key"), obj.ModTime, obj.Body)
+		return nil
+	}
+}
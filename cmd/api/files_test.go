@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bueti/shrinkster/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func TestFilesHandlerServesLocalStorage(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewLocal(dir, filesPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{}
+	e := echo.New()
+	e.GET(filesPrefix+"/:key", app.filesHandler(store))
+
+	location, err := store.Put(context.Background(), "qr-code-test.png", "image/png", strings.NewReader("png data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, location, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d, want 200", location, rec.Code)
+	}
+	if body := rec.Body.String(); body != "png data" {
+		t.Errorf("GET %s: body %q, want %q", location, body, "png data")
+	}
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != "image/png" {
+		t.Errorf("GET %s: content type %q, want image/png", location, ct)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, filesPrefix+"/missing.png", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET missing file: status %d, want 404", rec.Code)
+	}
+}
+
+func TestLocalStorageRejectsTraversal(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "files")
+	store, err := storage.NewLocal(dir, filesPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(root, "secret"), []byte("secret"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"../secret", "..", "a/../../secret", `..\secret`, ""} {
+		_, err := store.Put(context.Background(), key, "text/plain", strings.NewReader("x"))
+		if !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		_, err = store.Open(context.Background(), key)
+		if !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("Open(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+
+	app := &application{}
+	e := echo.New()
+	e.GET(filesPrefix+"/:key", app.filesHandler(store))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, filesPrefix+"/..%2Fsecret", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET %s/..%%2Fsecret: status %d, want 404", filesPrefix, rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("GET %s/..%%2Fsecret served the file outside the storage directory", filesPrefix)
+	}
+}
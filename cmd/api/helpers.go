@@ -1,10 +1,14 @@
 package main
 
 import (
+	"errors"
+	"net/http"
 	"time"
 
+	"github.com/bueti/shrinkster/internal/model"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/pascaldekloe/jwt"
 )
 
 func (app *application) isAuthenticated(c echo.Context) bool {
@@ -12,11 +16,43 @@ func (app *application) isAuthenticated(c echo.Context) bool {
 }
 
 func (app *application) newTemplateData(c echo.Context) *templateData {
+	// there is no token if the csrf middleware was skipped
+	csrfToken, _ := c.Get(middleware.DefaultCSRFConfig.ContextKey).(string)
 	return &templateData{
 		CurrentYear:     time.Now().Year(),
 		Flash:           app.sessionManager.PopString(c.Request().Context(), "flash"),
 		FlashError:      app.sessionManager.PopString(c.Request().Context(), "flash_error"),
 		IsAuthenticated: app.isAuthenticated(c),
-		CSRFToken:       c.Get(middleware.DefaultCSRFConfig.ContextKey).(string),
+		CSRFToken:       csrfToken,
 	}
 }
+
+// renderFormErrors renders a form page again with the submitted values and
+// the field errors of err. Other errors are returned as they are.
+func (app *application) renderFormErrors(c echo.Context, page string, form any, err error) error {
+	var fields model.FieldErrors
+	if !errors.As(err, &fields) {
+		return err
+	}
+	data := app.newTemplateData(c)
+	data.Form = form
+	data.FieldErrors = fields
+	return c.Render(http.StatusBadRequest, page, data)
+}
+
+// newAuthToken issues a signed JWT for the given user which is valid for 24 hours.
+func (app *application) newAuthToken(user *model.User) (string, error) {
+	var claims jwt.Claims
+	claims.Subject = user.ID.String()
+	claims.Issued = jwt.NewNumericTime(time.Now())
+	claims.NotBefore = jwt.NewNumericTime(time.Now())
+	claims.Expires = jwt.NewNumericTime(time.Now().Add(24 * time.Hour))
+	claims.Issuer = "shrink.ch"
+	claims.Audiences = []string{"shrink.ch"}
+
+	jwtBytes, err := claims.HMACSign(jwt.HS256, []byte(app.config.signingKey))
+	if err != nil {
+		return "", err
+	}
+	return string(jwtBytes), nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	// mailWorkerInterval is how often the outbox is checked for due emails.
+	mailWorkerInterval = 10 * time.Second
+	mailBatchSize      = 20
+	// expiryReminderLead is how long before the expiry of a link its owner is reminded.
+	expiryReminderLead     = 3 * 24 * time.Hour
+	expiryReminderInterval = time.Hour
+)
+
+// enqueueEmail puts an email into the outbox. It is rendered and sent by the
+// mail worker, failed deliveries are retried. Errors are logged, callers
+// which record that an email went out must check them too.
+func (app *application) enqueueEmail(recipient, template string, data map[string]any) error {
+	err := app.models.Emails.Enqueue(recipient, template, data)
+	if err != nil {
+		log.Errorf("failed to enqueue %s for %s: %v", template, recipient, err)
+	}
+	return err
+}
+
+// runMailWorker sends the emails in the outbox until ctx is cancelled.
+func (app *application) runMailWorker(ctx context.Context) {
+	ticker := time.NewTicker(mailWorkerInterval)
+	defer ticker.Stop()
+
+	for {
+		app.drainOutbox(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drainOutbox sends all due emails, batch by batch.
+func (app *application) drainOutbox(ctx context.Context) {
+	for ctx.Err() == nil {
+		emails, err := app.models.Emails.Claim(mailBatchSize)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
+		for i := range emails {
+			app.deliver(&emails[i])
+		}
+
+		if len(emails) < mailBatchSize {
+			return
+		}
+	}
+}
+
+func (app *application) deliver(email *model.Email) {
+	data, err := email.TemplateData()
+	if err == nil {
+		err = app.mailer.Send(email.Recipient, email.Template, data)
+		app.metrics.countEmail(err)
+	}
+
+	if err != nil {
+		log.Errorf("failed to send %s to %s: %v", email.Template, email.Recipient, err)
+		err = app.models.Emails.MarkFailed(email, err)
+	} else {
+		err = app.models.Emails.MarkSent(email)
+	}
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// runExpiryReminders reminds link owners of links which expire soon, until ctx is cancelled.
+func (app *application) runExpiryReminders(ctx context.Context) {
+	ticker := time.NewTicker(expiryReminderInterval)
+	defer ticker.Stop()
+
+	for {
+		app.sendExpiryReminders()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) sendExpiryReminders() {
+	urls, err := app.models.Urls.ExpiringBefore(time.Now().Add(expiryReminderLead))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	for i := range urls {
+		url := &urls[i]
+		err = app.enqueueEmail(url.User.Email, "link_expiry.tmpl.html", map[string]any{
+			"name":      url.User.Name,
+			"shortUrl":  genFullUrl(app.baseURL(), url.ShortUrl),
+			"original":  url.Original,
+			"expiresAt": url.ExpiresAt.UTC().Format("02 Jan 2006 at 15:04 MST"),
+		})
+		if err != nil {
+			// try again on the next run
+			continue
+		}
+
+		err = app.models.Urls.SetExpiryReminderSent(url)
+		if err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// baseURL is the public url of this instance, see -base-url. It is used
+// where there is no request to take the host from, like in emails sent in
+// the background.
+func (app *application) baseURL() string {
+	return app.config.baseURL
+}
+
+// adminEmailsHandler handles the display of the emails which could not be delivered.
+func (app *application) adminEmailsHandler(c echo.Context) error {
+	data := app.newTemplateData(c)
+	emails, err := app.models.Emails.ListFailed()
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Internal Server Error. Please try again later.")
+		return c.Render(http.StatusInternalServerError, "home.tmpl.html", app.newTemplateData(c))
+	}
+	data.Emails = emails
+	return c.Render(http.StatusOK, "admin_emails.tmpl.html", data)
+}
+
+// retryEmailHandlerPost puts a failed email back into the outbox.
+func (app *application) retryEmailHandlerPost(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Bad Request?!")
+		return c.Redirect(http.StatusSeeOther, "/admin/emails")
+	}
+
+	err = app.models.Emails.Retry(uint(id))
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Failed to retry the email.")
+		return c.Redirect(http.StatusSeeOther, "/admin/emails")
+	}
+
+	app.sessionManager.Put(c.Request().Context(), "flash", "Email queued for another attempt.")
+	return c.Redirect(http.StatusSeeOther, "/admin/emails")
+}
+
+// discardEmailHandlerPost deletes a failed email.
+func (app *application) discardEmailHandlerPost(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Bad Request?!")
+		return c.Redirect(http.StatusSeeOther, "/admin/emails")
+	}
+
+	err = app.models.Emails.Discard(uint(id))
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Failed to discard the email.")
+		return c.Redirect(http.StatusSeeOther, "/admin/emails")
+	}
+
+	app.sessionManager.Put(c.Request().Context(), "flash", "Email discarded.")
+	return c.Redirect(http.StatusSeeOther, "/admin/emails")
+}
@@ -4,22 +4,24 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alexedwards/scs/postgresstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/bueti/shrinkster/internal/mailer"
 	"github.com/bueti/shrinkster/internal/model"
+	"github.com/bueti/shrinkster/internal/ratelimit"
+	"github.com/bueti/shrinkster/internal/safety"
+	"github.com/bueti/shrinkster/internal/storage"
 	"github.com/labstack/echo/v4"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 const version = "0.0.1"
@@ -40,14 +42,44 @@ type config struct {
 		password string
 		sender   string
 	}
+	mail struct {
+		transport string
+		dir       string
+	}
+	storage struct {
+		backend string
+		dir     string
+	}
 	aws struct {
 		region          string
 		bucket          string
 		accessKeyID     string
 		secretAccessKey string
 	}
-	signingKey string
-	debug      bool
+	rateLimit struct {
+		enabled   bool
+		links     ratelimit.Policy
+		auth      ratelimit.Policy
+		redirects ratelimit.Policy
+		reports   ratelimit.Policy
+	}
+	safety struct {
+		ownHosts      string
+		blocklistFile string
+	}
+	metrics struct {
+		addr  string
+		token string
+	}
+	// baseURL is the public url of this instance, used for links in emails.
+	baseURL string
+	// trustedProxies are the reverse proxies whose X-Forwarded-For header is trusted.
+	trustedProxies []*net.IPNet
+	// trustCFHeaders enables reading the country of clicks from the
+	// CF-IPCountry header, only safe if all requests come through Cloudflare.
+	trustCFHeaders bool
+	signingKey     string
+	debug          bool
 }
 
 type application struct {
@@ -56,7 +88,13 @@ type application struct {
 	mailer         mailer.Mailer
 	models         model.Models
 	sessionManager *scs.SessionManager
-	uploader       *s3manager.Uploader
+	storage        storage.Storage
+	loginThrottle  *loginThrottle
+	rateLimiter    ratelimit.Store
+	validator      *safety.Validator
+	qrCache        *qrCache
+	openAPI        []byte
+	metrics        *metrics
 }
 
 func main() {
@@ -72,10 +110,40 @@ func main() {
 	flag.StringVar(&cfg.smtp.username, "smtp-username", "bbu+shrink@ik.me", "SMTP username")
 	flag.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "no-reply@shrink.ch", "SMTP sender")
+	flag.StringVar(&cfg.mail.transport, "mail-transport", "smtp", "Mail transport (smtp|log|maildir)")
+	flag.StringVar(&cfg.mail.dir, "mail-dir", "./data/mail", "Directory for the maildir mail transport")
+	flag.StringVar(&cfg.storage.backend, "storage", "s3", "Storage backend for QR codes (s3|local|db)")
+	flag.StringVar(&cfg.storage.dir, "storage-dir", "./data/files", "Directory for the local storage backend")
 	flag.StringVar(&cfg.aws.region, "aws-region", "eu-central-1", "AWS S3 region")
 	flag.StringVar(&cfg.aws.bucket, "aws-bucket", "shrink.ch", "AWS S3 bucket")
 	flag.StringVar(&cfg.aws.accessKeyID, "aws-access-key-id", "", "AWS access key ID")
 	flag.StringVar(&cfg.aws.secretAccessKey, "aws-secret-access-key", "", "AWS secret access key")
+	flag.StringVar(&cfg.baseURL, "base-url", "https://shrink.ch", "Public URL of this instance, used for links in emails")
+	flag.StringVar(&cfg.safety.ownHosts, "own-hosts", "shrink.ch", "Comma separated hosts this instance is reachable at, links to them are rejected")
+	flag.StringVar(&cfg.safety.blocklistFile, "blocklist-file", "", "File with blocked domains, one per line")
+	flag.StringVar(&cfg.metrics.addr, "metrics-addr", "", "Address of a separate listener for /metrics, e.g. 127.0.0.1:9090")
+	flag.StringVar(&cfg.metrics.token, "metrics-token", "", "Bearer token required for /metrics")
+	flag.BoolVar(&cfg.rateLimit.enabled, "ratelimit-enabled", true, "Enable rate limiting")
+	flag.Float64Var(&cfg.rateLimit.links.Rate, "ratelimit-links-rps", 0.2, "Rate limiter link creation requests per second")
+	flag.IntVar(&cfg.rateLimit.links.Burst, "ratelimit-links-burst", 10, "Rate limiter link creation burst")
+	flag.Float64Var(&cfg.rateLimit.auth.Rate, "ratelimit-auth-rps", 0.1, "Rate limiter authentication requests per second")
+	flag.IntVar(&cfg.rateLimit.auth.Burst, "ratelimit-auth-burst", 5, "Rate limiter authentication burst")
+	flag.Float64Var(&cfg.rateLimit.redirects.Rate, "ratelimit-redirects-rps", 20, "Rate limiter redirect requests per second")
+	flag.IntVar(&cfg.rateLimit.redirects.Burst, "ratelimit-redirects-burst", 50, "Rate limiter redirect burst")
+	flag.Float64Var(&cfg.rateLimit.reports.Rate, "ratelimit-reports-rps", 0.05, "Rate limiter abuse report requests per second")
+	flag.IntVar(&cfg.rateLimit.reports.Burst, "ratelimit-reports-burst", 3, "Rate limiter abuse report burst")
+
+	flag.Func("trusted-proxies", "Comma separated CIDR ranges of reverse proxies whose X-Forwarded-For header is trusted", func(v string) error {
+		for _, cidr := range strings.Split(v, ",") {
+			_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				return err
+			}
+			cfg.trustedProxies = append(cfg.trustedProxies, ipNet)
+		}
+		return nil
+	})
+	flag.BoolVar(&cfg.trustCFHeaders, "trust-cf-headers", false, "Read the country of clicks from the CF-IPCountry header set by Cloudflare")
 
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
@@ -87,6 +155,15 @@ func main() {
 	}
 
 	parsEnvVars(&cfg)
+	baseURL, err := parseBaseURL(cfg.baseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.baseURL = baseURL
+	cfg.rateLimit.links.Name = "links"
+	cfg.rateLimit.auth.Name = "auth"
+	cfg.rateLimit.redirects.Name = "redirects"
+	cfg.rateLimit.reports.Name = "reports"
 
 	db, err := openDB(cfg)
 	if err != nil {
@@ -99,10 +176,23 @@ func main() {
 		&model.Url{},
 		&model.Session{},
 		&model.Token{},
+		&model.DeviceAuthorization{},
+		&model.DomainRule{},
+		&model.Report{},
+		&model.Email{},
+		&model.Click{},
+		&storage.Blob{},
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
+	// urls used to be unique across all users
+	if db.Migrator().HasIndex(&model.Url{}, "idx_urls_original") {
+		err = db.Migrator().DropIndex(&model.Url{}, "idx_urls_original")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	dbd, _ := db.DB()
 
@@ -110,24 +200,45 @@ func main() {
 	sessionManager.Store = postgresstore.New(dbd)
 	sessionManager.Lifetime = 14 * 24 * time.Hour
 
-	// AWS Client
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(cfg.aws.region)},
-	)
-	uploader := s3manager.NewUploader(sess)
+	store, err := openStorage(cfg, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	transport, err := openMailTransport(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var checkers []safety.Checker
+	if cfg.safety.blocklistFile != "" {
+		blocklist, err := safety.LoadList(cfg.safety.blocklistFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		checkers = append(checkers, safety.NewListChecker(blocklist, "is on the local blocklist"))
+	}
 
 	app := &application{
+		config:         cfg,
 		sessionManager: sessionManager,
-		mailer:         mailer.New(cfg.smtp.server, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
-		uploader:       uploader,
+		mailer:         mailer.New(transport, cfg.smtp.sender),
+		storage:        store,
+		loginThrottle:  newLoginThrottle(),
+		rateLimiter:    ratelimit.NewMemoryStore(),
+		qrCache:        newQRCache(qrCacheSize),
 	}
 
 	app.echo = app.initEcho()
 	app.models = model.NewModels(db)
-	app.config = cfg
+	app.metrics = newMetrics(dbd, app.models.Sessions.Count)
+	app.validator = safety.NewValidator(strings.Split(cfg.safety.ownHosts, ","), app.models.Domains, checkers...)
 
 	app.registerMiddleware()
-	app.registerRoutes()
+	err = app.registerRoutes()
+	if err != nil {
+		log.Fatal(err)
+	}
 	app.serve()
 
 }
@@ -149,6 +260,41 @@ func parsEnvVars(cfg *config) {
 		cfg.signingKey = envSigningKey
 	}
 
+	if cfg.smtp.sender == "" {
+		envSMTPSender := os.Getenv("SMTP_SENDER")
+		if envSMTPSender == "" {
+			log.Fatal("SMTP_SENDER is required")
+		}
+		cfg.smtp.sender = envSMTPSender
+	}
+
+	if cfg.mail.transport == "smtp" {
+		parseSMTPEnvVars(cfg)
+	}
+
+	if cfg.storage.backend == "s3" {
+		parseAWSEnvVars(cfg)
+	}
+
+	if cfg.metrics.token == "" {
+		cfg.metrics.token = os.Getenv("METRICS_TOKEN")
+	}
+
+	_, cfg.debug = os.LookupEnv("DEBUG")
+}
+
+// parseBaseURL checks that base is an absolute http or https url and
+// returns it without a trailing slash.
+func parseBaseURL(base string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("-base-url must be an absolute http or https url, got %q", base)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// parseSMTPEnvVars reads the SMTP settings, they are only required by the smtp mail transport.
+func parseSMTPEnvVars(cfg *config) {
 	if cfg.smtp.server == "" {
 		envSMTPServer := os.Getenv("SMTP_SERVER")
 		if envSMTPServer == "" {
@@ -184,15 +330,10 @@ func parsEnvVars(cfg *config) {
 		}
 		cfg.smtp.port = port
 	}
+}
 
-	if cfg.smtp.sender == "" {
-		envSMTPSender := os.Getenv("SMTP_SENDER")
-		if envSMTPSender == "" {
-			log.Fatal("SMTP_SENDER is required")
-		}
-		cfg.smtp.sender = envSMTPSender
-	}
-
+// parseAWSEnvVars reads the AWS credentials, they are only required by the s3 storage backend.
+func parseAWSEnvVars(cfg *config) {
 	if cfg.aws.secretAccessKey == "" {
 		secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
 		if secretKey == "" {
@@ -208,8 +349,34 @@ func parsEnvVars(cfg *config) {
 		}
 		cfg.aws.accessKeyID = accessKey
 	}
+}
 
-	_, cfg.debug = os.LookupEnv("DEBUG")
+// openStorage creates the storage backend selected by the configuration.
+func openStorage(cfg config, db *gorm.DB) (storage.Storage, error) {
+	switch cfg.storage.backend {
+	case "s3":
+		return storage.NewS3(cfg.aws.region, cfg.aws.bucket)
+	case "local":
+		return storage.NewLocal(cfg.storage.dir, filesPrefix)
+	case "db":
+		return storage.NewDatabase(db, filesPrefix), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.storage.backend)
+	}
+}
+
+// openMailTransport creates the mail transport selected by the configuration.
+func openMailTransport(cfg config) (mailer.Transport, error) {
+	switch cfg.mail.transport {
+	case "smtp":
+		return mailer.NewSMTP(cfg.smtp.server, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password), nil
+	case "log":
+		return mailer.NewLog(os.Stdout), nil
+	case "maildir":
+		return mailer.NewMaildir(cfg.mail.dir)
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.mail.transport)
+	}
 }
 
 func openDB(cfg config) (*gorm.DB, error) {
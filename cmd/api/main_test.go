@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestParseBaseURL(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"https://shrink.ch", "https://shrink.ch", false},
+		{"https://shrink.ch/", "https://shrink.ch", false},
+		{"http://localhost:8080", "http://localhost:8080", false},
+		{"https://example.com/shrink/", "https://example.com/shrink", false},
+		{"", "", true},
+		{"https://", "", true},
+		{"shrink.ch", "", true},
+		{"ftp://shrink.ch", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseBaseURL(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseBaseURL(%q) = %q, %v, want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics are the Prometheus metrics of the server, served on /metrics.
+type metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	redirects       *prometheus.CounterVec
+	emails          *prometheus.CounterVec
+	qrRender        prometheus.Histogram
+}
+
+// Results of the redirects counter.
+const (
+	redirectHit      = "hit"
+	redirectMiss     = "miss"
+	redirectDisabled = "disabled"
+	redirectExpired  = "expired"
+)
+
+// newMetrics registers the metrics. db is the connection pool, sessions
+// counts the active sessions on each scrape.
+func newMetrics(db *sql.DB, sessions func() (int64, error)) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shrinkster_http_requests_total",
+			Help: "Number of HTTP requests by route and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "shrinkster_http_request_duration_seconds",
+			Help:    "Latency of HTTP requests by route and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shrinkster_redirects_total",
+			Help: "Number of short link lookups by result: hit, miss, disabled or expired.",
+		}, []string{"result"}),
+		emails: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shrinkster_emails_sent_total",
+			Help: "Number of email deliveries by result: success or failure.",
+		}, []string{"result"}),
+		qrRender: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "shrinkster_qr_render_duration_seconds",
+			Help:    "Time to render a QR code.",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "shrinkster"),
+		m.requests,
+		m.requestDuration,
+		m.redirects,
+		m.emails,
+		m.qrRender,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "shrinkster_sessions",
+			Help: "Number of active sessions in the session store.",
+		}, func() float64 {
+			n, err := sessions()
+			if err != nil {
+				return -1
+			}
+			return float64(n)
+		}),
+	)
+	return m
+}
+
+// middleware counts the requests and measures their latency. Requests are
+// labeled with their route, not the path, to keep the number of series small.
+func (m *metrics) middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+		if err != nil {
+			// let the error handler write the response, to get its status
+			c.Error(err)
+		}
+
+		route := c.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+		labels := prometheus.Labels{
+			"method": methodLabel(c.Request().Method),
+			"route":  route,
+			"status": strconv.Itoa(c.Response().Status),
+		}
+		m.requests.With(labels).Inc()
+		m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+		return nil
+	}
+}
+
+// methodLabel returns the label of an HTTP method. Unknown methods are
+// labeled "other", as clients can send any method.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// observeQRRender records the time since start as the duration of a QR code rendering.
+func (m *metrics) observeQRRender(start time.Time) {
+	m.qrRender.Observe(time.Since(start).Seconds())
+}
+
+// countEmail counts an email delivery, err is the result of sending it.
+func (m *metrics) countEmail(err error) {
+	if err != nil {
+		m.emails.WithLabelValues("failure").Inc()
+		return
+	}
+	m.emails.WithLabelValues("success").Inc()
+}
+
+// handler serves the metrics. With a token, requests need it as bearer token.
+func (m *metrics) handler(token string) http.Handler {
+	h := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := "Bearer " + token
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// serveMetrics serves the metrics on their own listener, it blocks until
+// the listener fails.
+func (app *application) serveMetrics() {
+	if app.config.metrics.token == "" {
+		log.Warnf("metrics on %s are served without a token, make sure the address isn't publicly reachable", app.config.metrics.addr)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", app.metrics.handler(app.config.metrics.token))
+	srv := &http.Server{
+		Addr:              app.config.metrics.addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		app.echo.Logger.Errorf("metrics listener: %v", err)
+	}
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/bueti/shrinkster/internal/authz"
 	"github.com/bueti/shrinkster/internal/model"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -19,6 +21,11 @@ func (app *application) authenticate(next echo.HandlerFunc) echo.HandlerFunc {
 		if !app.isAuthenticated(c) {
 			return c.Render(http.StatusUnauthorized, "login.tmpl.html", app.newTemplateData(c))
 		}
+		user, err := app.sessionUser(c)
+		if err != nil {
+			return c.Render(http.StatusUnauthorized, "login.tmpl.html", app.newTemplateData(c))
+		}
+		model.SetContextUser(c, user)
 		c.Request().Header.Set("Cache-Control", "no-store")
 		return next(c)
 
@@ -28,56 +35,74 @@ func (app *application) authenticate(next echo.HandlerFunc) echo.HandlerFunc {
 func (app *application) jsonAuthenticate(c echo.Context, next echo.HandlerFunc) error {
 	authorizationHeader := c.Request().Header.Get("Authorization")
 	if authorizationHeader == "" {
-		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+		return jsonError(c, http.StatusUnauthorized, "Unauthorized")
 	}
 
 	headerParts := strings.Split(authorizationHeader, " ")
 	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-		return c.JSON(http.StatusBadRequest, "Bad Request")
+		return invalidToken(c)
 	}
 
 	token := headerParts[1]
 	claims, err := jwt.HMACCheck([]byte(token), []byte(app.config.signingKey))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, "Invalid Token")
+		return invalidToken(c)
 	}
 	if !claims.Valid(time.Now()) {
-		return c.JSON(http.StatusBadRequest, "Invalid Token")
+		return invalidToken(c)
 	}
 	if claims.Issuer != "shrink.ch" {
-		return c.JSON(http.StatusBadRequest, "Invalid Token")
+		return invalidToken(c)
 	}
 	if !claims.AcceptAudience("shrink.ch") {
-		return c.JSON(http.StatusBadRequest, "Invalid Token")
+		return invalidToken(c)
 	}
 
 	userID, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, "Invalid Token")
+		return invalidToken(c)
 	}
 
 	user, err := app.models.Users.GetByID(userID)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, "Invalid Token")
+		return invalidToken(c)
 	}
 
-	app.sessionManager.Put(c.Request().Context(), "userID", user.ID.String())
+	// bearer token requests are stateless, the user is only kept for this request
+	model.SetContextUser(c, user)
 
 	return next(c)
 }
 
+// invalidToken rejects a request with a malformed or invalid bearer token.
+// The unversioned api responds with 400, as older clients expect.
+func invalidToken(c echo.Context) error {
+	if !isV1(c) {
+		return jsonError(c, http.StatusBadRequest, "Invalid Token")
+	}
+	return jsonError(c, http.StatusUnauthorized, "Invalid Token")
+}
+
+// apiAuthenticate authenticates requests to the versioned api with the
+// bearer token, regardless of their content type.
+func (app *application) apiAuthenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return app.jsonAuthenticate(c, next)
+	}
+}
+
 func (app *application) requireRole(role string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			// Get the authenticated user's role
 			userRole, err := app.models.Users.GetRole(c)
 			if err != nil {
-				return c.JSON(http.StatusUnauthorized, "Unauthorized")
+				return jsonError(c, http.StatusUnauthorized, "Unauthorized")
 			}
 
 			// Check if the user has the required role
 			if userRole != role {
-				return c.JSON(http.StatusForbidden, "Access Denied")
+				return jsonError(c, http.StatusForbidden, "Access Denied")
 			}
 
 			// If the user has the required role, call the next handler
@@ -86,60 +111,90 @@ func (app *application) requireRole(role string) echo.MiddlewareFunc {
 	}
 }
 
-func (app *application) mustBeOwner(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		user, err := app.userFromContext(c)
-		if err != nil {
-			return c.Render(http.StatusUnauthorized, "home.tmpl.html", app.newTemplateData(c))
-		}
-		// admins are allowed to see anything
-		if user.Role == "admin" {
-			return next(c)
-		}
+// resource describes how a route loads the resource it acts on and which
+// policy guards it.
+type resource struct {
+	// key is the name of the resource in the context.
+	key string
+	// name is used in the not found error, it must match the one of load.
+	name   string
+	load   func(c echo.Context) (any, error)
+	policy authz.Policy
+}
 
-		handlerName := c.Path()
-		if handlerName == "/api/urls" && c.Request().Method == http.MethodDelete {
-			urlReq := new(model.UrlDeleteRequest)
-			if err := c.Bind(urlReq); err != nil {
-				return c.JSON(http.StatusBadRequest, err.Error())
+// authorize loads the resource of a request and only lets it through if the
+// policy of the resource allows the authenticated user to perform action on
+// it. The handler finds the resource in the context. A denied resource is
+// reported as not found, so users can't probe which ids exist.
+func (app *application) authorize(res resource, action authz.Action) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, err := app.userFromContext(c)
+			if err != nil {
+				return err
 			}
-			// Store urlReq in context
-			app.sessionManager.Put(c.Request().Context(), "urlReq", urlReq)
-			//c.Set("urlReq", urlReq)
-
-			url := app.models.Urls.Find(urlReq.ID)
 
-			if url.UserID != user.ID {
-				return c.JSON(http.StatusUnauthorized, "Unauthorized")
-			}
-			return next(c)
-		}
-		if handlerName == "/api/urls/:user_id" {
-			userReqID := c.Param("user_id")
-			userRedUUID, err := uuid.Parse(userReqID)
+			r, err := res.load(c)
 			if err != nil {
-				return c.JSON(http.StatusBadRequest, err.Error())
+				return err
 			}
-
-			if user.ID != userRedUUID {
-				return c.JSON(http.StatusUnauthorized, "Unauthorized")
+			if err := authz.Check(res.policy, user, action, r); err != nil {
+				if errors.Is(err, model.ErrForbidden) {
+					return model.Errorf(model.ErrNotFound, "%s not found", res.name)
+				}
+				return err
 			}
+
+			c.Set(res.key, r)
 			return next(c)
 		}
-		if handlerName == "/urls/:id" && c.Request().Method == http.MethodPost {
-			urlUUID, err := uuid.Parse(c.Param("id"))
-			if err != nil {
-				return c.JSON(http.StatusBadRequest, err.Error())
-			}
+	}
+}
 
-			url := app.models.Urls.Find(urlUUID)
+// urlResource is the url of the :id or :code path parameter, by id or short
+// code. It is stored as "url".
+func (app *application) urlResource() resource {
+	return resource{key: "url", name: "url", policy: authz.Urls, load: func(c echo.Context) (any, error) {
+		ref := c.Param("id")
+		if ref == "" {
+			ref = c.Param("code")
+		}
+		if id, err := uuid.Parse(ref); err == nil {
+			return app.findUrl(id)
+		}
+		return app.models.Urls.GetByShortUrl(ref)
+	}}
+}
 
-			if url.UserID != user.ID {
-				return c.JSON(http.StatusUnauthorized, "Unauthorized")
-			}
-			return next(c)
+// urlBodyResource is the url with the id in the request body, as sent by
+// the unversioned delete. It is stored as "url".
+func (app *application) urlBodyResource() resource {
+	return resource{key: "url", name: "url", policy: authz.Urls, load: func(c echo.Context) (any, error) {
+		urlReq := new(model.UrlDeleteRequest)
+		if err := c.Bind(urlReq); err != nil {
+			return nil, err
 		}
+		return app.findUrl(urlReq.ID)
+	}}
+}
+
+// userResource is the user of the path parameter param. It is stored as
+// "account", "user" being the authenticated user.
+func (app *application) userResource(param string) resource {
+	return resource{key: "account", name: "user", policy: authz.Users, load: func(c echo.Context) (any, error) {
+		id, err := uuid.Parse(c.Param(param))
+		if err != nil {
+			return nil, model.Errorf(model.ErrValidation, "%s must be an uuid", param)
+		}
+		return app.models.Users.GetByID(id)
+	}}
+}
 
-		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+// findUrl returns the url with the id, Find reports a missing url as nil.
+func (app *application) findUrl(id uuid.UUID) (*model.Url, error) {
+	url := app.models.Urls.Find(id)
+	if url == nil {
+		return nil, model.Errorf(model.ErrNotFound, "url not found")
 	}
+	return url, nil
 }
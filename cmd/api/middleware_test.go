@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bueti/shrinkster/internal/authz"
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// TestAuthorizeHidesForeignResources checks that a url of another user
+// can't be told apart from a missing one.
+func TestAuthorizeHidesForeignResources(t *testing.T) {
+	owner := &model.User{ID: uuid.New(), Role: "user"}
+	other := &model.User{ID: uuid.New(), Role: "user"}
+	admin := &model.User{ID: uuid.New(), Role: authz.RoleAdmin}
+	existing := &model.Url{ID: uuid.New(), UserID: owner.ID}
+
+	urls := resource{key: "url", name: "url", policy: authz.Urls, load: func(c echo.Context) (any, error) {
+		if c.Param("id") != existing.ID.String() {
+			return nil, model.Errorf(model.ErrNotFound, "url not found")
+		}
+		return existing, nil
+	}}
+
+	app := &application{}
+	app.echo = echo.New()
+	app.echo.HTTPErrorHandler = app.httpErrorHandler
+	var user *model.User
+	setUser := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			model.SetContextUser(c, user)
+			return next(c)
+		}
+	}
+	app.echo.GET(apiV1Prefix+"/urls/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, setUser, app.authorize(urls, authz.Read))
+
+	get := func(id uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, apiV1Prefix+"/urls/"+id.String(), nil)
+		rec := httptest.NewRecorder()
+		app.echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	user = other
+	foreign, missing := get(existing.ID), get(uuid.New())
+	if foreign.Code != http.StatusNotFound || missing.Code != http.StatusNotFound {
+		t.Errorf("non-owner: status = %d for another user's url and %d for a missing one, want 404", foreign.Code, missing.Code)
+	}
+	if foreign.Body.String() != missing.Body.String() {
+		t.Errorf("non-owner: body = %s for another user's url, want %s as for a missing one", foreign.Body, missing.Body)
+	}
+
+	for _, user = range []*model.User{owner, admin} {
+		if rec := get(existing.ID); rec.Code != http.StatusNoContent {
+			t.Errorf("role %s: status = %d, want 204", user.Role, rec.Code)
+		}
+	}
+	user = admin
+	if rec := get(uuid.New()); rec.Code != http.StatusNotFound {
+		t.Errorf("admin: status = %d for a missing url, want 404", rec.Code)
+	}
+}
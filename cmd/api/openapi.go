@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// openAPIVersion is the version of the versioned api in the document.
+const openAPIVersion = "1.0.0"
+
+// newOpenAPI generates the OpenAPI 3 document of the routes.
+func newOpenAPI(routes []apiRoute) ([]byte, error) {
+	g := schemaGenerator{components: map[string]any{
+		"Error": errorSchema(),
+	}}
+
+	paths := map[string]map[string]any{}
+	for _, r := range routes {
+		path := openAPIPath(r.Path)
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(r.Method)] = g.operation(r)
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Shrinkster API",
+			"version":     openAPIVersion,
+			"description": "Errors are sent as {\"error\": {\"code\": \"...\", \"message\": \"...\"}}.",
+		},
+		"servers": []any{map[string]any{"url": apiV1Prefix}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": g.components,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// openAPIHandlerJson serves the OpenAPI document of the versioned api.
+func (app *application) openAPIHandlerJson(c echo.Context) error {
+	return c.JSONBlob(http.StatusOK, app.openAPI)
+}
+
+func (g *schemaGenerator) operation(r apiRoute) map[string]any {
+	op := map[string]any{
+		"summary":     r.Summary,
+		"operationId": operationID(r),
+		"tags":        []string{r.Tag},
+	}
+
+	var params []any
+	for _, p := range r.Params {
+		schema := map[string]any{"type": p.Type}
+		if p.Format != "" {
+			schema["format"] = p.Format
+		}
+		params = append(params, map[string]any{
+			"name":        p.Name,
+			"in":          p.In,
+			"required":    p.In == "path",
+			"description": p.Description,
+			"schema":      schema,
+		})
+	}
+	if params != nil {
+		op["parameters"] = params
+	}
+
+	if r.Request != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  jsonContent(g.schema(reflect.TypeOf(r.Request))),
+		}
+	}
+
+	success := map[string]any{"description": http.StatusText(r.Status)}
+	if r.Response != nil {
+		success["content"] = jsonContent(g.schema(reflect.TypeOf(r.Response)))
+	}
+	responses := map[string]any{
+		strconv.Itoa(r.Status): success,
+		"default": map[string]any{
+			"description": "Error",
+			"content":     jsonContent(map[string]any{"$ref": "#/components/schemas/Error"}),
+		},
+	}
+	op["responses"] = responses
+
+	if r.Auth {
+		op["security"] = []any{map[string]any{"bearerAuth": []string{}}}
+	}
+	if r.Admin {
+		op["description"] = "Requires the admin role."
+	}
+	return op
+}
+
+// operationID derives an id like getUrlsIdStats from the method and path.
+func operationID(r apiRoute) string {
+	id := strings.ToLower(r.Method)
+	for _, part := range strings.Split(r.Path, "/") {
+		part = strings.TrimPrefix(part, ":")
+		part = strings.TrimSuffix(part, ".json")
+		for _, word := range strings.FieldsFunc(part, func(r rune) bool { return r == '-' || r == '_' }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
+
+func jsonContent(schema any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+func errorSchema() map[string]any {
+	return map[string]any{
+		"type":     "object",
+		"required": []string{"error"},
+		"properties": map[string]any{
+			"error": map[string]any{
+				"type":     "object",
+				"required": []string{"code", "message"},
+				"properties": map[string]any{
+					"code": map[string]any{
+						"type": "string",
+						"enum": []string{codeBadRequest, codeUnauthorized, codeForbidden, codeNotFound, codeMethod, codeConflict, codeRateLimited, codeInternal},
+					},
+					"message": map[string]any{"type": "string"},
+					"fields": map[string]any{
+						"type":                 "object",
+						"description":          "Validation errors by field name.",
+						"additionalProperties": map[string]any{"type": "string"},
+					},
+					"existing": map[string]any{
+						"type":        "object",
+						"description": "The link the user already has, when shortening a url again.",
+						"properties": map[string]any{
+							"id":          map[string]any{"type": "string", "format": "uuid"},
+							"full_url":    map[string]any{"type": "string"},
+							"qr_code_url": map[string]any{"type": "string"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// schemaGenerator derives JSON schemas from Go types the way encoding/json
+// marshals them. Named structs become components.
+type schemaGenerator struct {
+	components map[string]any
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	uuidType          = reflect.TypeOf(uuid.UUID{})
+	deletedAtType     = reflect.TypeOf(gorm.DeletedAt{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case uuidType:
+		return map[string]any{"type": "string", "format": "uuid"}
+	case deletedAtType:
+		return map[string]any{"type": "string", "format": "date-time", "nullable": true}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := g.schema(t.Elem())
+		if _, ok := s["$ref"]; ok {
+			return map[string]any{"allOf": []any{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Implements(textMarshalerType) {
+			return map[string]any{"type": "string"}
+		}
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.components[t.Name()]; !ok {
+			// reserve the name first, in case the type refers to itself
+			g.components[t.Name()] = nil
+			g.components[t.Name()] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+// object returns the schema of a struct. Fields of embedded structs are
+// inlined, as encoding/json does.
+func (g *schemaGenerator) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	g.fields(t, properties, &required)
+
+	s := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+func (g *schemaGenerator) fields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, properties, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		properties[name] = g.schema(f.Type)
+		if isRequired(f, opts) {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// isRequired reports whether a field is always present: request fields
+// validated as required, and response fields which aren't omitted.
+func isRequired(f reflect.StructField, jsonOpts string) bool {
+	if validate, ok := f.Tag.Lookup("validate"); ok {
+		return strings.Contains(validate, "required")
+	}
+	return !strings.Contains(jsonOpts, "omitempty") && f.Type.Kind() != reflect.Pointer
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/bueti/shrinkster/internal/ratelimit"
+	"github.com/labstack/echo/v4"
+)
+
+// TestOpenAPIMatchesRoutes checks that the OpenAPI document describes
+// exactly the routes registered below apiV1Prefix.
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	app := &application{
+		sessionManager: scs.New(),
+		rateLimiter:    ratelimit.NewMemoryStore(),
+	}
+	app.echo = echo.New()
+	if err := app.registerRoutes(); err != nil {
+		t.Fatal(err)
+	}
+
+	var registered []string
+	for _, r := range app.echo.Routes() {
+		if !strings.HasPrefix(r.Path, apiV1Prefix+"/") {
+			continue
+		}
+		registered = append(registered, r.Method+" "+openAPIPath(strings.TrimPrefix(r.Path, apiV1Prefix)))
+	}
+
+	var doc struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(app.openAPI, &doc); err != nil {
+		t.Fatal(err)
+	}
+	var documented []string
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	sort.Strings(registered)
+	sort.Strings(documented)
+	if strings.Join(registered, "\n") != strings.Join(documented, "\n") {
+		t.Errorf("registered routes:\n%s\n\ndocumented routes:\n%s", strings.Join(registered, "\n"), strings.Join(documented, "\n"))
+	}
+	if len(registered) == 0 {
+		t.Error("no routes registered below " + apiV1Prefix)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// pagination reads the page and page_size query parameters. Pages start at 1.
+func pagination(c echo.Context) (page, pageSize int, err error) {
+	page, pageSize = 1, defaultPageSize
+
+	if v := c.QueryParam("page"); v != "" {
+		page, err = strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("page must be a positive number")
+		}
+	}
+	if v := c.QueryParam("page_size"); v != "" {
+		pageSize, err = strconv.Atoi(v)
+		if err != nil || pageSize < 1 || pageSize > maxPageSize {
+			return 0, 0, fmt.Errorf("page_size must be between 1 and %d", maxPageSize)
+		}
+	}
+	return page, pageSize, nil
+}
+
+// setPaginationHeaders sets X-Total-Count and a Link header pointing to the
+// next page, if there is one.
+func setPaginationHeaders(c echo.Context, page, pageSize int, total int64) {
+	h := c.Response().Header()
+	h.Set("X-Total-Count", strconv.FormatInt(total, 10))
+
+	if int64(page*pageSize) >= total {
+		return
+	}
+	query := c.Request().URL.Query()
+	query.Set("page", strconv.Itoa(page+1))
+	query.Set("page_size", strconv.Itoa(pageSize))
+	h.Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, c.Request().URL.Path, query.Encode()))
+}
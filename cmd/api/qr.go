@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/bueti/shrinkster/internal/qr"
+	"github.com/bueti/shrinkster/ui"
+	"github.com/labstack/echo/v4"
+)
+
+// qrCacheSize is the number of rendered QR codes kept in memory.
+const qrCacheSize = 512
+
+// qrCodeHandler renders the QR code of a short url on demand. The image can
+// be styled with query parameters, see qrOptionsFromQuery.
+func (app *application) qrCodeHandler(c echo.Context) error {
+	url, err := app.models.Urls.GetByShortUrl(c.Param("code"))
+	if err != nil {
+		return err
+	}
+	return app.serveQRCode(c, url)
+}
+
+// serveQRCode sends the QR code of url. The endpoint is used as image
+// source, so errors are sent as plain text rather than json.
+func (app *application) serveQRCode(c echo.Context, url *model.Url) error {
+	if url.Disabled {
+		return c.String(http.StatusForbidden, "This link has been disabled")
+	}
+
+	opts, err := app.qrOptionsFromQuery(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	content := genFullUrl(c.Scheme()+"://"+c.Request().Host, url.ShortUrl)
+	etag := qrETag(content, opts)
+
+	h := c.Response().Header()
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", "public, max-age=86400")
+	if c.Request().Header.Get("If-None-Match") == etag {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	data, ok := app.qrCache.Get(etag)
+	if !ok {
+		buf := new(bytes.Buffer)
+		start := time.Now()
+		err = qr.Render(buf, content, opts)
+		app.metrics.observeQRRender(start)
+		if err != nil {
+			return err
+		}
+		data = buf.Bytes()
+		app.qrCache.Add(etag, data)
+	}
+
+	return c.Blob(http.StatusOK, opts.ContentType(), data)
+}
+
+// qrOptionsFromQuery reads the rendering options from the query parameters
+// format, size, margin, fg, bg, level and logo.
+func (app *application) qrOptionsFromQuery(c echo.Context) (qr.Options, error) {
+	opts := qr.DefaultOptions()
+
+	if format := c.QueryParam("format"); format != "" {
+		opts.Format = format
+	}
+	if size := c.QueryParam("size"); size != "" {
+		v, err := strconv.Atoi(size)
+		if err != nil {
+			return opts, fmt.Errorf("size must be a number")
+		}
+		opts.Size = v
+	}
+	if margin := c.QueryParam("margin"); margin != "" {
+		v, err := strconv.Atoi(margin)
+		if err != nil {
+			return opts, fmt.Errorf("margin must be a number")
+		}
+		opts.Margin = v
+	}
+	if fg := c.QueryParam("fg"); fg != "" {
+		opts.Foreground = fg
+	}
+	if bg := c.QueryParam("bg"); bg != "" {
+		opts.Background = bg
+	}
+	if level := c.QueryParam("level"); level != "" {
+		opts.Level = level
+	}
+	if logo, _ := strconv.ParseBool(c.QueryParam("logo")); logo {
+		img, err := qrLogo()
+		if err != nil {
+			return opts, err
+		}
+		opts.Logo = img
+	}
+
+	return opts, opts.Validate()
+}
+
+// qrETag derives the entity tag from everything that influences the image.
+func qrETag(content string, opts qr.Options) string {
+	key := fmt.Sprintf("%s|%s|%d|%d|%s|%s|%s|%t",
+		content, opts.Format, opts.Size, opts.Margin, opts.Foreground, opts.Background, opts.Level, opts.Logo != nil)
+	sum := sha256.Sum256([]byte(key))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+var (
+	logoOnce sync.Once
+	logoImg  image.Image
+	logoErr  error
+)
+
+// qrLogo returns the Shrinkster logo which can be placed in the center of QR codes.
+func qrLogo() (image.Image, error) {
+	logoOnce.Do(func() {
+		f, err := ui.Files.Open("static/logo.png")
+		if err != nil {
+			logoErr = err
+			return
+		}
+		defer f.Close()
+		logoImg, logoErr = png.Decode(f)
+	})
+	return logoImg, logoErr
+}
+
+// qrCache is a LRU cache of rendered QR codes keyed by their ETag.
+type qrCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type qrCacheEntry struct {
+	key  string
+	data []byte
+}
+
+func newQRCache(size int) *qrCache {
+	return &qrCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (q *qrCache) Get(key string) ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	el, ok := q.entries[key]
+	if !ok {
+		return nil, false
+	}
+	q.order.MoveToFront(el)
+	return el.Value.(*qrCacheEntry).data, true
+}
+
+func (q *qrCache) Add(key string, data []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if el, ok := q.entries[key]; ok {
+		q.order.MoveToFront(el)
+		return
+	}
+	q.entries[key] = q.order.PushFront(&qrCacheEntry{key: key, data: data})
+
+	for q.order.Len() > q.size {
+		oldest := q.order.Back()
+		q.order.Remove(oldest)
+		delete(q.entries, oldest.Value.(*qrCacheEntry).key)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/bueti/shrinkster/internal/qr"
+	"github.com/labstack/echo/v4"
+)
+
+func newQRApp() *application {
+	app := &application{
+		qrCache: newQRCache(qrCacheSize),
+		metrics: newMetrics(nil, nil),
+	}
+	app.echo = echo.New()
+	return app
+}
+
+// getQRCode requests the QR code of url with the query and headers.
+func (app *application) getQRCode(t *testing.T, url *model.Url, query string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/s/"+url.ShortUrl+"/qr?"+query, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	if err := app.serveQRCode(app.echo.NewContext(req, rec), url); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestQROptionsFromQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    qr.Options
+		wantErr string
+	}{
+		{"", qr.DefaultOptions(), ""},
+		{"format=SVG&size=512&margin=0&fg=%23FF0000&bg=00ff00&level=h",
+			qr.Options{Format: qr.FormatSVG, Size: 512, Margin: 0, Foreground: "ff0000", Background: "00ff00", Level: "H"}, ""},
+		{"format=gif", qr.Options{}, "format"},
+		{"size=big", qr.Options{}, "size must be a number"},
+		{"size=10", qr.Options{}, "size must be between"},
+		{"size=100000", qr.Options{}, "size must be between"},
+		{"margin=x", qr.Options{}, "margin must be a number"},
+		{"margin=-1", qr.Options{}, "margin must be between"},
+		{"fg=red", qr.Options{}, "foreground"},
+		{"fg=f00", qr.Options{}, "foreground"},
+		{"bg=%23gggggg", qr.Options{}, "background"},
+		{"level=X", qr.Options{}, "level"},
+	}
+
+	app := newQRApp()
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/s/abc/qr?"+tt.query, nil)
+		opts, err := app.qrOptionsFromQuery(app.echo.NewContext(req, httptest.NewRecorder()))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: err = %v, want %q", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		if opts != tt.want {
+			t.Errorf("%q: options = %+v, want %+v", tt.query, opts, tt.want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/s/abc/qr?logo=true&level=L", nil)
+	opts, err := app.qrOptionsFromQuery(app.echo.NewContext(req, httptest.NewRecorder()))
+	if err != nil || opts.Logo == nil || opts.Level != "H" {
+		t.Errorf("logo: options = %+v, %v, want the logo and level H", opts, err)
+	}
+}
+
+func TestQRCodeHandler(t *testing.T) {
+	app := newQRApp()
+	url := &model.Url{ShortUrl: "abc"}
+
+	rec := app.getQRCode(t, url, "", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentType) != "image/png" {
+		t.Fatalf("status = %d, content type = %q, want a png", rec.Code, rec.Header().Get(echo.HeaderContentType))
+	}
+	if !bytes.HasPrefix(rec.Body.Bytes(), []byte("\x89PNG")) {
+		t.Error("body is not a png")
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	if _, ok := app.qrCache.Get(etag); !ok {
+		t.Error("the rendered code was not cached")
+	}
+
+	rec = app.getQRCode(t, url, "", http.Header{"If-None-Match": {etag}})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("revalidation: status = %d with %d bytes, want an empty 304", rec.Code, rec.Body.Len())
+	}
+
+	rec = app.getQRCode(t, url, "format=svg", http.Header{"If-None-Match": {etag}})
+	if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentType) != "image/svg+xml" {
+		t.Errorf("svg: status = %d, content type = %q", rec.Code, rec.Header().Get(echo.HeaderContentType))
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Error("svg has the ETag of the png")
+	}
+
+	// the same options in another spelling are the same image
+	rec = app.getQRCode(t, url, "fg=%23000000&level=m", nil)
+	if rec.Header().Get("ETag") != etag {
+		t.Errorf("ETag = %s for the default options, want %s", rec.Header().Get("ETag"), etag)
+	}
+
+	rec = app.getQRCode(t, url, "size=big", nil)
+	if rec.Code != http.StatusBadRequest || !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), echo.MIMETextPlain) {
+		t.Errorf("invalid options: status = %d, content type = %q, want a plain 400", rec.Code, rec.Header().Get(echo.HeaderContentType))
+	}
+
+	rec = app.getQRCode(t, &model.Url{ShortUrl: "off", Disabled: true}, "", nil)
+	if rec.Code != http.StatusForbidden || !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), echo.MIMETextPlain) {
+		t.Errorf("disabled: status = %d, content type = %q, want a plain 403", rec.Code, rec.Header().Get(echo.HeaderContentType))
+	}
+}
+
+func TestQRCache(t *testing.T) {
+	c := newQRCache(2)
+	c.Add("a", []byte("a"))
+	c.Add("b", []byte("b"))
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a is missing")
+	}
+
+	// b is the least recently used entry now
+	c.Add("c", []byte("c"))
+	if _, ok := c.Get("b"); ok {
+		t.Error("b was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if data, ok := c.Get(key); !ok || string(data) != key {
+			t.Errorf("Get(%s) = %q, %v", key, data, ok)
+		}
+	}
+
+	// adding a cached key doesn't replace or duplicate it
+	c.Add("a", []byte("new"))
+	if data, _ := c.Get("a"); string(data) != "a" || c.order.Len() != 2 {
+		t.Errorf("Get(a) = %q with %d entries", data, c.order.Len())
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bueti/shrinkster/internal/ratelimit"
+	"github.com/labstack/echo/v4"
+)
+
+// rateLimit limits requests according to the given policy. Authenticated
+// requests are counted per user, anonymous requests per IP address.
+func (app *application) rateLimit(policy ratelimit.Policy) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !app.config.rateLimit.enabled {
+				return next(c)
+			}
+
+			res, err := app.rateLimiter.Take(policy.Name+":"+app.rateLimitKey(c), policy, time.Now())
+			if err != nil {
+				// don't lock everybody out if the store is unavailable
+				c.Logger().Error(err)
+				return next(c)
+			}
+
+			h := c.Response().Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+			if !res.Allowed {
+				retryAfter := ceilSeconds(res.RetryAfter)
+				h.Set("Retry-After", strconv.Itoa(retryAfter))
+				if wantsJSON(c) {
+					return jsonError(c, http.StatusTooManyRequests, "Too Many Requests")
+				}
+				// browsers get the error page, e.g. after too many logins
+				return echo.NewHTTPError(http.StatusTooManyRequests,
+					fmt.Sprintf("Too many requests, please try again in %d seconds.", retryAfter))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// rateLimitKey identifies the client of a request. Anonymous clients are
+// keyed by IP, which is only taken from X-Forwarded-For behind a trusted
+// proxy, see clientIPExtractor.
+func (app *application) rateLimitKey(c echo.Context) string {
+	if user, err := app.userFromContext(c); err == nil {
+		return "user:" + user.ID.String()
+	}
+	if app.isAuthenticated(c) {
+		if userID := app.sessionManager.GetString(c.Request().Context(), "userID"); userID != "" {
+			return "user:" + userID
+		}
+	}
+	return "ip:" + c.RealIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
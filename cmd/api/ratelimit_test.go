@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/bueti/shrinkster/internal/ratelimit"
+	"github.com/labstack/echo/v4"
+	session "github.com/spazzymoto/echo-scs-session"
+)
+
+func newRateLimitedApp(policy ratelimit.Policy) *application {
+	app := &application{
+		sessionManager: scs.New(),
+		rateLimiter:    ratelimit.NewMemoryStore(),
+	}
+	app.config.rateLimit.enabled = true
+	app.echo = app.initEcho()
+	app.echo.Use(session.LoadAndSave(app.sessionManager))
+
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	limit := app.rateLimit(policy)
+	app.echo.POST("/login", ok, limit)
+	app.echo.POST("/api/login", ok, limit)
+	app.echo.POST(apiV1Prefix+"/login", ok, limit)
+	return app
+}
+
+func TestRateLimit(t *testing.T) {
+	// one token per minute, so the clock doesn't move during the test
+	policy := ratelimit.Policy{Name: "auth", Rate: 1.0 / 60, Burst: 2}
+
+	tests := []struct {
+		path        string
+		contentType string
+		body        func(t *testing.T, body string)
+	}{
+		{"/login", echo.MIMEApplicationForm, func(t *testing.T, body string) {
+			if !strings.Contains(body, "<html") || !strings.Contains(body, "try again in 60 seconds") {
+				t.Errorf("body = %q, want the error page", body)
+			}
+		}},
+		{"/api/login", echo.MIMEApplicationJSON, func(t *testing.T, body string) {
+			var msg string
+			if err := json.Unmarshal([]byte(body), &msg); err != nil || msg != "Too Many Requests" {
+				t.Errorf("body = %q, want the bare message", body)
+			}
+		}},
+		{apiV1Prefix + "/login", echo.MIMEApplicationJSON, func(t *testing.T, body string) {
+			var e apiError
+			if err := json.Unmarshal([]byte(body), &e); err != nil || e.Error.Code != codeRateLimited {
+				t.Errorf("body = %q, want the rate_limited error", body)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		app := newRateLimitedApp(policy)
+		do := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			req.Header.Set(echo.HeaderContentType, tt.contentType)
+			rec := httptest.NewRecorder()
+			app.echo.ServeHTTP(rec, req)
+			return rec
+		}
+
+		for remaining := 1; remaining >= 0; remaining-- {
+			rec := do()
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s: status = %d, want 200", tt.path, rec.Code)
+			}
+			h := rec.Header()
+			if h.Get("RateLimit-Limit") != "2" || h.Get("RateLimit-Remaining") != strconv.Itoa(remaining) {
+				t.Errorf("%s: RateLimit-Limit = %q, RateLimit-Remaining = %q, want 2 and %d",
+					tt.path, h.Get("RateLimit-Limit"), h.Get("RateLimit-Remaining"), remaining)
+			}
+			if h.Get("Retry-After") != "" {
+				t.Errorf("%s: Retry-After is set on an allowed request", tt.path)
+			}
+		}
+
+		rec := do()
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("%s: status = %d, want 429", tt.path, rec.Code)
+		}
+		if got := rec.Header().Get("Retry-After"); got != "60" {
+			t.Errorf("%s: Retry-After = %q, want 60", tt.path, got)
+		}
+		if got := rec.Header().Get("RateLimit-Reset"); got != "120" {
+			t.Errorf("%s: RateLimit-Reset = %q, want 120", tt.path, got)
+		}
+		tt.body(t, rec.Body.String())
+	}
+}
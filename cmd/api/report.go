@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+type reportForm struct {
+	model.ReportRequest
+	Reasons []string
+}
+
+// reportHandler handles the display of the public report form.
+func (app *application) reportHandler(c echo.Context) error {
+	data := app.newTemplateData(c)
+	data.Form = reportForm{
+		ReportRequest: model.ReportRequest{ShortCode: c.QueryParam("code")},
+		Reasons:       model.ReportReasons,
+	}
+	return c.Render(http.StatusOK, "report.tmpl.html", data)
+}
+
+// reportHandlerPost handles the submission of an abuse report.
+func (app *application) reportHandlerPost(c echo.Context) error {
+	req := model.ReportRequest{
+		ShortCode:     shortCodeFromInput(c.FormValue("short_code")),
+		Reason:        c.FormValue("reason"),
+		Details:       c.FormValue("details"),
+		ReporterEmail: c.FormValue("email"),
+	}
+
+	form := reportForm{ReportRequest: req, Reasons: model.ReportReasons}
+
+	if err := c.Validate(&req); err != nil {
+		return app.renderFormErrors(c, "report.tmpl.html", form, err)
+	}
+
+	url, err := app.models.Urls.GetByShortUrl(req.ShortCode)
+	if err != nil {
+		if !errors.Is(err, model.ErrNotFound) {
+			return err
+		}
+		return app.renderFormErrors(c, "report.tmpl.html", form, model.FieldErrors{"short_code": "does not exist"})
+	}
+
+	_, err = app.models.Reports.Create(url, &req, c.RealIP())
+	if err != nil {
+		if !errors.Is(err, model.ErrValidation) {
+			return err
+		}
+		return app.renderFormErrors(c, "report.tmpl.html", form, model.FieldErrors{"reason": "must be one of " + strings.Join(model.ReportReasons, ", ")})
+	}
+
+	app.sessionManager.Put(c.Request().Context(), "flash", "Thank you for your report. We will look into it.")
+	return c.Render(http.StatusOK, "home.tmpl.html", app.newTemplateData(c))
+}
+
+// adminReportsHandler handles the display of the open abuse reports and
+// the disabled urls, which can be enabled again from there.
+func (app *application) adminReportsHandler(c echo.Context) error {
+	data := app.newTemplateData(c)
+	reports, err := app.models.Reports.ListOpen()
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Internal Server Error. Please try again later.")
+		return c.Render(http.StatusInternalServerError, "home.tmpl.html", app.newTemplateData(c))
+	}
+	disabled, err := app.models.Urls.ListDisabled()
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Internal Server Error. Please try again later.")
+		return c.Render(http.StatusInternalServerError, "home.tmpl.html", app.newTemplateData(c))
+	}
+	data.Reports = reports
+	data.Urls = disabled
+	return c.Render(http.StatusOK, "admin_reports.tmpl.html", data)
+}
+
+// disableUrlHandlerPost disables a url and notifies its owner.
+func (app *application) disableUrlHandlerPost(c echo.Context) error {
+	url, ok := app.urlFromParam(c)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/admin/reports")
+	}
+
+	reason := strings.TrimSpace(c.FormValue("reason"))
+	if reason == "" {
+		reason = "reported as abusive"
+	}
+
+	err := app.models.Urls.SetDisabled(url, true, reason)
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Failed to disable the url.")
+		return c.Redirect(http.StatusSeeOther, "/admin/reports")
+	}
+
+	err = app.models.Reports.ResolveAllForUrl(url.ID)
+	if err != nil {
+		log.Error(err)
+	}
+
+	owner, err := app.models.Users.GetByID(url.UserID)
+	if err != nil {
+		log.Error(err)
+	} else {
+		sendLinkDisabledEmail(owner, url, genFullUrl(c.Scheme()+"://"+c.Request().Host, url.ShortUrl), app)
+	}
+
+	app.sessionManager.Put(c.Request().Context(), "flash", "Url disabled and owner notified.")
+	return c.Redirect(http.StatusSeeOther, "/admin/reports")
+}
+
+// enableUrlHandlerPost re-enables a disabled url.
+func (app *application) enableUrlHandlerPost(c echo.Context) error {
+	url, ok := app.urlFromParam(c)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, "/admin/reports")
+	}
+
+	err := app.models.Urls.SetDisabled(url, false, "")
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Failed to enable the url.")
+		return c.Redirect(http.StatusSeeOther, "/admin/reports")
+	}
+
+	app.sessionManager.Put(c.Request().Context(), "flash", "Url enabled.")
+	return c.Redirect(http.StatusSeeOther, "/admin/reports")
+}
+
+// dismissReportHandlerPost closes a report without taking action.
+func (app *application) dismissReportHandlerPost(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Bad Request?!")
+		return c.Redirect(http.StatusSeeOther, "/admin/reports")
+	}
+
+	report, err := app.models.Reports.Get(uint(id))
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Report not found.")
+		return c.Redirect(http.StatusSeeOther, "/admin/reports")
+	}
+
+	err = app.models.Reports.SetStatus(report, model.ReportStatusDismissed)
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Failed to dismiss the report.")
+		return c.Redirect(http.StatusSeeOther, "/admin/reports")
+	}
+
+	app.sessionManager.Put(c.Request().Context(), "flash", "Report dismissed.")
+	return c.Redirect(http.StatusSeeOther, "/admin/reports")
+}
+
+// urlFromParam loads the url of the :id path parameter and puts a flash
+// message into the session if that fails.
+func (app *application) urlFromParam(c echo.Context) (*model.Url, bool) {
+	urlUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Bad Request?!")
+		return nil, false
+	}
+
+	url := app.models.Urls.Find(urlUUID)
+	if url == nil {
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Url not found.")
+		return nil, false
+	}
+	return url, true
+}
+
+// shortCodeFromInput accepts a short code or a full short url.
+func shortCodeFromInput(input string) string {
+	input = strings.TrimSpace(input)
+	if i := strings.LastIndex(input, "/s/"); i >= 0 {
+		input = input[i+len("/s/"):]
+	}
+	return strings.TrimSuffix(input, "/")
+}
+
+func sendLinkDisabledEmail(user *model.User, url *model.Url, fullUrl string, app *application) {
+	app.enqueueEmail(user.Email, "link_disabled.tmpl.html", map[string]any{
+		"name":     user.Name,
+		"shortUrl": fullUrl,
+		"original": url.Original,
+		"reason":   url.DisabledReason,
+	})
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"net"
 	"net/http"
 	"strings"
 
+	"github.com/bueti/shrinkster/internal/authz"
+	"github.com/bueti/shrinkster/internal/storage"
 	"github.com/bueti/shrinkster/ui"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -16,12 +19,34 @@ func (app *application) initEcho() *echo.Echo {
 	e.Renderer = &Template{
 		templates: app.initTemplate(),
 	}
+	e.HTTPErrorHandler = app.httpErrorHandler
+	e.IPExtractor = clientIPExtractor(app.config.trustedProxies)
+	e.Validator = newRequestValidator()
 
 	return e
 }
 
+// clientIPExtractor determines the client IP used by the login throttle, the
+// rate limits and abuse reports. Forwarded headers are only trusted from the
+// configured proxies, otherwise clients could pick any IP they like.
+func clientIPExtractor(trustedProxies []*net.IPNet) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	opts := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, ipNet := range trustedProxies {
+		opts = append(opts, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(opts...)
+}
+
 func (app *application) registerMiddleware() {
 	app.echo.Use(middleware.Logger())
+	app.echo.Use(app.metrics.middleware)
 	app.echo.Use(middleware.Recover())
 	app.echo.Use(middleware.Gzip())
 	app.echo.Use(middleware.CORS())
@@ -40,9 +65,18 @@ func (app *application) registerMiddleware() {
 	app.echo.Use(session.LoadAndSave(app.sessionManager))
 }
 
-func (app *application) registerRoutes() {
+func (app *application) registerRoutes() error {
 	fileServer := http.FileServer(http.FS(ui.Files))
 	app.echo.GET("/static/*filepath", echo.WrapHandler(fileServer))
+	if opener, ok := app.storage.(storage.Opener); ok {
+		app.echo.GET(filesPrefix+"/:key", app.filesHandler(opener))
+	}
+
+	// metrics are served on the main listener only if they are protected by
+	// a token, see serveMetrics for the separate listener
+	if app.config.metrics.addr == "" && app.config.metrics.token != "" {
+		app.echo.GET("/metrics", echo.WrapHandler(app.metrics.handler(app.config.metrics.token)))
+	}
 
 	// static pages
 	app.echo.GET("/", app.indexHandler)
@@ -53,20 +87,47 @@ func (app *application) registerRoutes() {
 	app.echo.GET("dashboard", app.dashboardHandler, app.authenticate)
 
 	// user
+	authLimit := app.rateLimit(app.config.rateLimit.auth)
 	app.echo.GET("/users/activate", app.activateUserHandler)
 	app.echo.GET("/users/resend-activation", app.resendActivationLinkHandler)
-	app.echo.POST("/users/resend-activation", app.resendActivationLinkHandlerPost)
+	app.echo.POST("/users/resend-activation", app.resendActivationLinkHandlerPost, authLimit)
+	app.echo.GET("/users/password-reset", app.passwordResetHandler)
+	app.echo.POST("/users/password-reset", app.passwordResetHandlerPost, authLimit)
+	app.echo.GET("/users/password", app.newPasswordHandler)
+	app.echo.POST("/users/password", app.newPasswordHandlerPost, authLimit)
+	app.echo.GET("/users/confirm-email", app.confirmEmailHandler)
+	app.echo.GET("/users/unsubscribe", app.unsubscribeHandler)
+	app.echo.GET("/settings", app.settingsHandler, app.authenticate)
+	app.echo.POST("/settings", app.settingsHandlerPost, app.authenticate)
 	app.echo.GET("/signup", app.signupHandler)
-	app.echo.POST("/signup", app.signupHandlerPost)
+	app.echo.POST("/signup", app.signupHandlerPost, authLimit)
 	app.echo.GET("/login", app.loginHandler)
-	app.echo.POST("/login", app.loginHandlerPost)
+	app.echo.POST("/login", app.loginHandlerPost, authLimit)
 	app.echo.POST("/logout", app.logoutHandlerPost)
+	app.echo.GET("/device", app.deviceHandler, app.authenticate)
+	app.echo.POST("/device", app.deviceHandlerPost, app.authenticate)
 
 	// url
+	linksLimit := app.rateLimit(app.config.rateLimit.links)
 	app.echo.GET("/urls/new", app.createUrlFormHandler, app.authenticate)
-	app.echo.POST("/urls", app.createUrlHandlerPost, app.authenticate)
-	app.echo.POST("/urls/:id", app.deleteUrlHandlerPost, app.authenticate, app.mustBeOwner)
-	app.echo.GET("/s/*", app.redirectUrlHandler)
+	app.echo.POST("/urls", app.createUrlHandlerPost, app.authenticate, linksLimit)
+	app.echo.POST("/urls/:id", app.deleteUrlHandlerPost, app.authenticate, app.authorize(app.urlResource(), authz.Delete))
+	app.echo.GET("/s/*", app.redirectUrlHandler, app.rateLimit(app.config.rateLimit.redirects))
+	app.echo.GET("/s/:code/qr", app.qrCodeHandler, app.rateLimit(app.config.rateLimit.redirects))
+
+	// abuse reports
+	app.echo.GET("/report", app.reportHandler)
+	app.echo.POST("/report", app.reportHandlerPost, app.rateLimit(app.config.rateLimit.reports))
+
+	// admin
+	admin := app.echo.Group("/admin", app.authenticate, app.requireRole("admin"))
+	admin.GET("/reports", app.adminReportsHandler)
+	admin.POST("/reports/:id/dismiss", app.dismissReportHandlerPost)
+	admin.POST("/urls/:id/disable", app.disableUrlHandlerPost)
+	admin.POST("/urls/:id/enable", app.enableUrlHandlerPost)
+	admin.GET("/emails", app.adminEmailsHandler)
+	admin.POST("/emails/:id/retry", app.retryEmailHandlerPost)
+	admin.POST("/emails/:id/discard", app.discardEmailHandlerPost)
 
 	// create a group for all api calls. these accept json and return json
 	api := app.echo.Group("/api")
@@ -76,14 +137,33 @@ func (app *application) registerRoutes() {
 
 	// api/users
 	api.GET("/users", app.listUsersHandlerJson, app.authenticate, app.requireRole("admin"))
-	api.GET("/users/:id", app.getUserHandlerJson, app.authenticate)
+	api.GET("/users/:id", app.getUserHandlerJson, app.authenticate, app.authorize(app.userResource("id"), authz.Read))
+	api.POST("/users/:id/unlock", app.unlockUserHandlerJsonPost, app.authenticate, app.requireRole("admin"))
 	api.GET("/users/activate", app.activateUserHandlerJson)
-	api.POST("/users/resend-activation", app.resendActivationLinkHandlerJsonPost)
-	api.POST("/signup", app.signupHandlerJsonPost)
-	api.POST("/login", app.loginHandlerJsonPost)
+	api.POST("/users/resend-activation", app.resendActivationLinkHandlerJsonPost, authLimit)
+	api.POST("/users/password-reset", app.passwordResetHandlerJsonPost, authLimit)
+	api.PUT("/users/password", app.newPasswordHandlerJsonPut, authLimit)
+	api.POST("/users/email", app.changeEmailHandlerJsonPost, app.authenticate)
+	api.PUT("/users/preferences", app.preferencesHandlerJsonPut, app.authenticate)
+	api.POST("/signup", app.signupHandlerJsonPost, authLimit)
+	api.POST("/login", app.loginHandlerJsonPost, authLimit)
+	api.POST("/device/code", app.deviceCodeHandlerJsonPost, authLimit)
+	// polling is throttled by the device flow itself, see deviceTokenHandlerJsonPost
+	api.POST("/device/token", app.deviceTokenHandlerJsonPost)
+
+	// api/domains
+	api.GET("/domains", app.listDomainRulesHandlerJson, app.authenticate, app.requireRole("admin"))
+	api.POST("/domains", app.createDomainRuleHandlerJsonPost, app.authenticate, app.requireRole("admin"))
+	api.DELETE("/domains/:id", app.deleteDomainRuleHandlerJson, app.authenticate, app.requireRole("admin"))
 
 	// api/urls
-	api.POST("/urls", app.createUrlHandlerJsonPost, app.authenticate)
-	api.DELETE("/urls", app.urlHandlerJsonDelete, app.authenticate, app.mustBeOwner)
-	api.GET("/urls/:user_id", app.getUrlByUserHandlerJson, app.authenticate, app.mustBeOwner)
+	api.POST("/urls", app.createUrlHandlerJsonPost, app.authenticate, linksLimit)
+	api.DELETE("/urls", app.urlHandlerJsonDelete, app.authenticate, app.authorize(app.urlBodyResource(), authz.Delete))
+	api.PUT("/urls/:id", app.updateUrlHandlerJsonPut, app.authenticate, app.authorize(app.urlResource(), authz.Update))
+	api.GET("/urls/:user_id", app.getUrlByUserHandlerJson, app.authenticate, app.authorize(app.userResource("user_id"), authz.Read))
+	api.GET("/urls/code/:code", app.getUrlByCodeHandlerJson, app.authenticate, app.authorize(app.urlResource(), authz.Read))
+	api.GET("/urls/code/:code/stats", app.urlStatsHandlerJson, app.authenticate, app.authorize(app.urlResource(), authz.Read))
+
+	// api/v1 is the versioned api, see apiv1.go
+	return app.registerAPIv1()
 }
@@ -10,6 +10,17 @@ import (
 )
 
 func (app *application) serve() error {
+	// Start background jobs, they are stopped once the server shuts down
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go app.runMailWorker(jobs)
+	go app.runExpiryReminders(jobs)
+	go app.runDigests(jobs)
+
+	if app.config.metrics.addr != "" {
+		go app.serveMetrics()
+	}
+
 	// Start server
 	go func() {
 		// Retrieve TLS key and certificate content from environment variables
@@ -33,7 +33,7 @@ func (app *application) dashboardHandler(c echo.Context) error {
 	user, err := app.userFromContext(c)
 	if err != nil {
 		app.sessionManager.Put(c.Request().Context(), "flash_error", "Bad Request, are you logged in?")
-		return c.Render(http.StatusInternalServerError, "home.tmpl.html", app.newTemplateData(c))
+		return c.Render(http.StatusUnauthorized, "home.tmpl.html", app.newTemplateData(c))
 	}
 
 	data := app.newTemplateData(c)
@@ -50,6 +50,11 @@ func (app *application) dashboardHandler(c echo.Context) error {
 		url.Original = urlByUserResponse.Original
 		url.Visits = urlByUserResponse.Visits
 		url.QRCodeURL = urlByUserResponse.QRCodeURL
+		if url.QRCodeURL == "" {
+			url.QRCodeURL = url.ShortUrl + "/qr"
+		}
+		url.Disabled = urlByUserResponse.Disabled
+		url.ExpiresAt = urlByUserResponse.ExpiresAt
 		url.CreatedAt = urlByUserResponse.CreatedAt
 		url.UpdatedAt = urlByUserResponse.UpdatedAt
 
@@ -60,18 +65,21 @@ func (app *application) dashboardHandler(c echo.Context) error {
 	return c.Render(http.StatusOK, "dashboard.tmpl.html", data)
 }
 
+// userFromContext returns the authenticated user of a request, see
+// authenticate and jsonAuthenticate.
 func (app *application) userFromContext(c echo.Context) (*model.User, error) {
-	userID := app.sessionManager.Get(c.Request().Context(), "userID")
-	if userID == nil {
+	return model.ContextUser(c)
+}
+
+// sessionUser loads the user logged in to the session.
+func (app *application) sessionUser(c echo.Context) (*model.User, error) {
+	userID := app.sessionManager.GetString(c.Request().Context(), "userID")
+	if userID == "" {
 		return nil, fmt.Errorf("no user id in session")
 	}
-	userUUID, err := uuid.Parse(userID.(string))
-	if err != nil {
-		return nil, err
-	}
-	user, err := app.models.Users.GetByID(userUUID)
+	userUUID, err := uuid.Parse(userID)
 	if err != nil {
 		return nil, err
 	}
-	return user, nil
+	return app.models.Users.GetByID(userUUID)
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+// defaultStatsPeriod is the period of the stats if since is not given.
+const defaultStatsPeriod = 30 * 24 * time.Hour
+
+// clickFromRequest records where a click came from. With trustCF the
+// country is taken from the CF-IPCountry header set by Cloudflare.
+func clickFromRequest(r *http.Request, trustCF bool) model.Click {
+	var click model.Click
+
+	if ref, err := url.Parse(r.Referer()); err == nil && ref.Host != "" {
+		click.Referrer = strings.ToLower(stripPort(ref.Host))
+		if len(click.Referrer) > 255 {
+			click.Referrer = click.Referrer[:255]
+		}
+	}
+
+	country := strings.ToUpper(r.Header.Get("CF-IPCountry"))
+	if trustCF && len(country) == 2 && country != "XX" && country[0] >= 'A' && country[0] <= 'Z' && country[1] >= 'A' && country[1] <= 'Z' {
+		click.Country = country
+	}
+
+	click.Device = deviceClass(r.UserAgent())
+	return click
+}
+
+// deviceClass guesses the kind of device from a user agent.
+func deviceClass(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return model.DeviceUnknown
+	case strings.Contains(ua, "bot"), strings.Contains(ua, "crawler"), strings.Contains(ua, "spider"),
+		strings.Contains(ua, "curl/"), strings.Contains(ua, "wget/"), strings.Contains(ua, "preview"):
+		return model.DeviceBot
+	case strings.Contains(ua, "ipad"), strings.Contains(ua, "tablet"),
+		strings.Contains(ua, "android") && !strings.Contains(ua, "mobile"):
+		return model.DeviceTablet
+	case strings.Contains(ua, "mobi"), strings.Contains(ua, "iphone"), strings.Contains(ua, "android"):
+		return model.DeviceMobile
+	default:
+		return model.DeviceDesktop
+	}
+}
+
+// urlStatsHandlerJson returns the clicks of a url over time and its top
+// referrers, countries and devices.
+func (app *application) urlStatsHandlerJson(c echo.Context) error {
+	url := c.Get("url").(*model.Url)
+
+	var err error
+	until := time.Now()
+	if v := c.QueryParam("until"); v != "" {
+		until, err = parseStatsTime(v)
+		if err != nil {
+			return jsonError(c, http.StatusBadRequest, "until: "+err.Error())
+		}
+	}
+	since := until.Add(-defaultStatsPeriod)
+	if v := c.QueryParam("since"); v != "" {
+		since, err = parseStatsTime(v)
+		if err != nil {
+			return jsonError(c, http.StatusBadRequest, "since: "+err.Error())
+		}
+	}
+	interval := c.QueryParam("interval")
+	if interval == "" {
+		interval = "day"
+	}
+
+	stats, err := app.models.Clicks.Stats(url.ID, since, until, interval)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, stats)
+}
+
+// parseStatsTime accepts RFC 3339 timestamps and dates.
+func parseStatsTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(expiryDateLayout, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("expected a date like 2006-01-02 or 2006-01-02T15:04:05Z")
+}
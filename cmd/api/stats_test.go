@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bueti/shrinkster/internal/model"
+)
+
+func TestClickFromRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  http.Header
+		trustCF bool
+		want    model.Click
+	}{
+		{"direct", nil, false, model.Click{Device: model.DeviceUnknown}},
+		{"referrer", http.Header{"Referer": {"https://News.Example.com:8443/item?id=1"}}, false,
+			model.Click{Referrer: "news.example.com", Device: model.DeviceUnknown}},
+		{"invalid referrer", http.Header{"Referer": {"not a url"}}, false,
+			model.Click{Device: model.DeviceUnknown}},
+		{"country ignored without trust", http.Header{"Cf-Ipcountry": {"CH"}}, false,
+			model.Click{Device: model.DeviceUnknown}},
+		{"country", http.Header{"Cf-Ipcountry": {"CH"}}, true,
+			model.Click{Country: "CH", Device: model.DeviceUnknown}},
+		{"lower case country", http.Header{"Cf-Ipcountry": {"de"}}, true,
+			model.Click{Country: "DE", Device: model.DeviceUnknown}},
+		{"unknown country", http.Header{"Cf-Ipcountry": {"XX"}}, true,
+			model.Click{Device: model.DeviceUnknown}},
+		{"tor", http.Header{"Cf-Ipcountry": {"T1"}}, true,
+			model.Click{Device: model.DeviceUnknown}},
+		{"invalid country", http.Header{"Cf-Ipcountry": {"CHE"}}, true,
+			model.Click{Device: model.DeviceUnknown}},
+		{"device", http.Header{"User-Agent": {"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)"}}, false,
+			model.Click{Device: model.DeviceMobile}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/s/abc", nil)
+		for k, v := range tt.header {
+			req.Header[k] = v
+		}
+		if got := clickFromRequest(req, tt.trustCF); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDeviceClass(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{"", model.DeviceUnknown},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36", model.DeviceDesktop},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148", model.DeviceMobile},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) Chrome/120.0 Mobile Safari/537.36", model.DeviceMobile},
+		{"Mozilla/5.0 (Linux; Android 13; SM-X700) Chrome/120.0 Safari/537.36", model.DeviceTablet},
+		{"Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X)", model.DeviceTablet},
+		{"Googlebot/2.1 (+http://www.google.com/bot.html)", model.DeviceBot},
+		{"curl/8.4.0", model.DeviceBot},
+		{"Slackbot-LinkExpanding 1.0", model.DeviceBot},
+	}
+	for _, tt := range tests {
+		if got := deviceClass(tt.userAgent); got != tt.want {
+			t.Errorf("deviceClass(%q) = %s, want %s", tt.userAgent, got, tt.want)
+		}
+	}
+}
@@ -17,12 +17,23 @@ type templateData struct {
 	CurrentYear     int
 	Url             *model.Url
 	Urls            []*model.Url
+	Reports         []model.Report
+	Emails          []model.Email
 	Form            any
+	FieldErrors     model.FieldErrors
 	Flash           string
 	FlashError      string
 	IsAuthenticated bool
 	CSRFToken       string
 	User            *model.User
+	Error           *pageError
+}
+
+// pageError is shown by the error page.
+type pageError struct {
+	Status  int
+	Title   string
+	Message string
 }
 
 type Template struct {
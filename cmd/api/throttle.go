@@ -0,0 +1,92 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// ipFreeAttempts is the number of failed logins an IP address gets before it is slowed down.
+	ipFreeAttempts = 5
+	ipBackoffBase  = time.Second
+	ipBackoffMax   = time.Hour
+	// ipAttemptTTL is how long failed logins of an IP address are remembered.
+	ipAttemptTTL = 24 * time.Hour
+)
+
+type loginAttempts struct {
+	failures     int
+	blockedUntil time.Time
+	lastFailure  time.Time
+}
+
+// loginThrottle tracks failed logins per IP address in memory. After
+// ipFreeAttempts failures every further attempt has to wait for an
+// exponentially growing backoff.
+type loginThrottle struct {
+	mu        sync.Mutex
+	attempts  map[string]*loginAttempts
+	lastSweep time.Time
+	// now is the clock, tests replace it.
+	now func() time.Time
+}
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{
+		attempts: make(map[string]*loginAttempts),
+		now:      time.Now,
+	}
+}
+
+// Allow reports whether a login from ip may be attempted now. If not, it
+// returns how long the client has to wait. An allowed attempt counts as
+// failed until Succeed is called, so concurrent attempts can't get past
+// the limit before their failures are recorded.
+func (t *loginThrottle) Allow(ip string) (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.sweep(now)
+
+	a, ok := t.attempts[ip]
+	if !ok {
+		a = &loginAttempts{}
+		t.attempts[ip] = a
+	}
+	if wait := a.blockedUntil.Sub(now); wait > 0 {
+		return false, wait
+	}
+
+	a.failures++
+	a.lastFailure = now
+	if a.failures >= ipFreeAttempts {
+		backoff := ipBackoffBase << (a.failures - ipFreeAttempts)
+		if backoff > ipBackoffMax || backoff <= 0 {
+			backoff = ipBackoffMax
+		}
+		a.blockedUntil = now.Add(backoff)
+	}
+	return true, 0
+}
+
+// Succeed forgets the failed logins from ip.
+func (t *loginThrottle) Succeed(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.attempts, ip)
+}
+
+// sweep removes stale entries, it is called with the lock held.
+func (t *loginThrottle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < time.Hour {
+		return
+	}
+	for ip, a := range t.attempts {
+		if now.Sub(a.lastFailure) > ipAttemptTTL {
+			delete(t.attempts, ip)
+		}
+	}
+	t.lastSweep = now
+}
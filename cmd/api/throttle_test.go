@@ -0,0 +1,108 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock which only moves when told to.
+type fakeClock struct {
+	t time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func TestLoginThrottleThreshold(t *testing.T) {
+	clock := newFakeClock()
+	throttle := newLoginThrottle()
+	throttle.now = clock.now
+
+	for i := 1; i <= ipFreeAttempts; i++ {
+		if ok, _ := throttle.Allow("192.0.2.1"); !ok {
+			t.Fatalf("attempt %d was throttled, want %d free attempts", i, ipFreeAttempts)
+		}
+	}
+	ok, wait := throttle.Allow("192.0.2.1")
+	if ok || wait != ipBackoffBase {
+		t.Fatalf("Allow after %d failures = %v, %v, want false, %v", ipFreeAttempts, ok, wait, ipBackoffBase)
+	}
+	if ok, _ := throttle.Allow("192.0.2.2"); !ok {
+		t.Error("another IP was throttled")
+	}
+}
+
+func TestLoginThrottleExpiry(t *testing.T) {
+	clock := newFakeClock()
+	throttle := newLoginThrottle()
+	throttle.now = clock.now
+
+	for i := 0; i < ipFreeAttempts; i++ {
+		throttle.Allow("192.0.2.1")
+	}
+	clock.advance(ipBackoffBase)
+	if ok, _ := throttle.Allow("192.0.2.1"); !ok {
+		t.Fatal("still throttled after the backoff")
+	}
+	// every further failure doubles the backoff
+	ok, wait := throttle.Allow("192.0.2.1")
+	if ok || wait != 2*ipBackoffBase {
+		t.Fatalf("Allow = %v, %v, want false, %v", ok, wait, 2*ipBackoffBase)
+	}
+
+	clock.advance(ipAttemptTTL + time.Hour)
+	throttle.Allow("192.0.2.3")
+	if _, ok := throttle.attempts["192.0.2.1"]; ok {
+		t.Error("stale attempts were not swept")
+	}
+}
+
+func TestLoginThrottleSucceedResets(t *testing.T) {
+	clock := newFakeClock()
+	throttle := newLoginThrottle()
+	throttle.now = clock.now
+
+	for i := 0; i < ipFreeAttempts-1; i++ {
+		throttle.Allow("192.0.2.1")
+	}
+	throttle.Succeed("192.0.2.1")
+	for i := 1; i <= ipFreeAttempts; i++ {
+		if ok, _ := throttle.Allow("192.0.2.1"); !ok {
+			t.Fatalf("attempt %d after a successful login was throttled", i)
+		}
+	}
+}
+
+func TestLoginThrottleConcurrent(t *testing.T) {
+	throttle := newLoginThrottle()
+	throttle.now = newFakeClock().now
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := throttle.Allow("192.0.2.1"); ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != ipFreeAttempts {
+		t.Errorf("%d concurrent attempts were allowed, want %d", allowed, ipFreeAttempts)
+	}
+}
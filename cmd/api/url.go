@@ -1,30 +1,55 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/bueti/shrinkster/internal/model"
+	"github.com/bueti/shrinkster/internal/qr"
+	"github.com/bueti/shrinkster/internal/safety"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"github.com/yeqown/go-qrcode/v2"
-	"github.com/yeqown/go-qrcode/writer/standard"
 )
 
+// expiryDateLayout is the format of the expiry date in the create url form.
+const expiryDateLayout = "2006-01-02"
+
 func (app *application) redirectUrlHandler(c echo.Context) error {
 	wildcardValue := c.Param("*")
 	shortUrl := strings.TrimSuffix(wildcardValue, "/")
-	url, err := app.models.Urls.GetRedirect(shortUrl)
+	url, err := app.models.Urls.GetRedirect(shortUrl, clickFromRequest(c.Request(), app.config.trustCFHeaders))
 	if err != nil {
-		return c.JSON(http.StatusNotFound, err.Error())
+		if errors.Is(err, model.ErrNotFound) {
+			app.metrics.redirects.WithLabelValues(redirectMiss).Inc()
+		}
+		return err
+	}
+
+	if url.Disabled {
+		app.metrics.redirects.WithLabelValues(redirectDisabled).Inc()
+		data := app.newTemplateData(c)
+		data.Url = &url
+		return c.Render(http.StatusForbidden, "disabled.tmpl.html", data)
+	}
+
+	if url.Expired() {
+		app.metrics.redirects.WithLabelValues(redirectExpired).Inc()
+		data := app.newTemplateData(c)
+		data.Url = &url
+		return c.Render(http.StatusGone, "expired.tmpl.html", data)
 	}
 
-	return c.Redirect(http.StatusPermanentRedirect, url.Original)
+	app.metrics.redirects.WithLabelValues(redirectHit).Inc()
+	// links can be edited, disabled or expire and every click is counted, so
+	// the redirect must not be cached
+	c.Response().Header().Set("Cache-Control", "private, no-store")
+	return c.Redirect(http.StatusFound, url.Original)
 }
 
 func (app *application) createUrlFormHandler(c echo.Context) error {
@@ -34,9 +59,19 @@ func (app *application) createUrlFormHandler(c echo.Context) error {
 	return c.Render(http.StatusOK, "create_url.tmpl.html", data)
 }
 
+// urlForm holds the values of the create url form.
+type urlForm struct {
+	Original  string
+	ShortCode string
+	ExpiresAt string
+}
+
 func (app *application) createUrlHandlerPost(c echo.Context) error {
-	original := c.FormValue("original")
-	shortCode := c.FormValue("short_code")
+	form := urlForm{
+		Original:  c.FormValue("original"),
+		ShortCode: c.FormValue("short_code"),
+		ExpiresAt: c.FormValue("expires_at"),
+	}
 
 	user, err := app.userFromContext(c)
 	if err != nil {
@@ -45,28 +80,55 @@ func (app *application) createUrlHandlerPost(c echo.Context) error {
 	}
 
 	urlReq := &model.UrlCreateRequest{
-		Original:  original,
-		ShortCode: shortCode,
+		Original:  form.Original,
+		ShortCode: form.ShortCode,
 		UserID:    user.ID,
 	}
+	fields := model.FieldErrors{}
+	if err := c.Validate(urlReq); err != nil && !errors.As(err, &fields) {
+		return err
+	}
+	if form.ExpiresAt != "" {
+		t, err := time.Parse(expiryDateLayout, form.ExpiresAt)
+		if err != nil {
+			fields["expires_at"] = "is not a valid date"
+		} else {
+			urlReq.ExpiresAt = &t
+		}
+	}
+	if _, ok := fields["original"]; !ok {
+		destination, err := app.validateDestination(c, form.Original)
+		if err != nil {
+			if !errors.Is(err, model.ErrValidation) {
+				return err
+			}
+			fields["original"] = err.Error()
+		}
+		urlReq.Original = destination
+	}
+	if len(fields) > 0 {
+		return app.renderFormErrors(c, "create_url.tmpl.html", form, fields)
+	}
+
 	url, err := app.models.Urls.Create(urlReq)
 	if err != nil {
-		switch err.Error() {
-		case "url already exists":
+		switch {
+		case errors.Is(err, model.ErrExpiryInPast):
+			fields["expires_at"] = "must be in the future"
+		case errors.Is(err, model.ErrShortCodeTooLong):
+			fields["short_code"] = "is too long"
+		case errors.Is(err, model.ErrConflict):
 			app.sessionManager.Put(c.Request().Context(), "flash_error", "URL already exists.")
-		case "url cannot start with shrink.ch/s/":
-			app.sessionManager.Put(c.Request().Context(), "flash_error", "URL cannot start with shrink.ch/s/")
-		case "user id is required":
-			app.sessionManager.Put(c.Request().Context(), "flash_error", "User ID is required.")
-		case "short_url is too long":
-			app.sessionManager.Put(c.Request().Context(), "flash_error", "Short URL is too long.")
+			data := app.newTemplateData(c)
+			data.Form = form
+			return c.Render(http.StatusConflict, "create_url.tmpl.html", data)
 		default:
-			app.sessionManager.Put(c.Request().Context(), "flash_error", "Failed to create url.")
+			return err
 		}
-		return c.Render(http.StatusBadRequest, "create_url.tmpl.html", app.newTemplateData(c))
+		return app.renderFormErrors(c, "create_url.tmpl.html", form, fields)
 	}
 
-	qrCodeURL, err := app.createQRCode(genFullUrl(fmt.Sprintf(c.Scheme()+"://"+c.Request().Host), url.ShortUrl))
+	qrCodeURL, err := app.createQRCode(c.Request().Context(), genFullUrl(fmt.Sprintf(c.Scheme()+"://"+c.Request().Host), url.ShortUrl))
 	if err != nil {
 		app.sessionManager.Put(c.Request().Context(), "flash_error", "Failed to create QR Code.")
 	}
@@ -83,94 +145,174 @@ func (app *application) createUrlHandlerPost(c echo.Context) error {
 }
 
 // createQRCode creates a QR Code for a given url. It returns the url to the QR Code.
-func (app *application) createQRCode(original string) (string, error) {
-	qrc, err := qrcode.New(original)
+func (app *application) createQRCode(ctx context.Context, original string) (string, error) {
+	buf := new(bytes.Buffer)
+	start := time.Now()
+	err := qr.Render(buf, original, qr.DefaultOptions())
+	app.metrics.observeQRRender(start)
+	if err != nil {
+		return "", fmt.Errorf("could not render image: %w", err)
+	}
+
+	// store image
+	key := fmt.Sprintf("qr-code-%s.png", uuid.New())
+	qrLocation, err := app.storage.Put(ctx, key, "image/png", buf)
+	if err != nil {
+		return "", fmt.Errorf("could not store file: %w", err)
+	}
+
+	return qrLocation, nil
+}
+
+// createUrlHandlerJsonPost creates a url for the authenticated user.
+func (app *application) createUrlHandlerJsonPost(c echo.Context) error {
+	user, err := app.userFromContext(c)
 	if err != nil {
-		return "", err
+		return jsonError(c, http.StatusUnauthorized, "Unauthorized")
 	}
+	return app.createUrlJson(c, user.ID)
+}
 
-	// generate a temporary file to store the image
-	f, err := os.CreateTemp("", "qr-code-*.png")
+// createUrlForUserHandlerJsonPost creates a url on behalf of the user of the
+// path. It is meant for admins.
+func (app *application) createUrlForUserHandlerJsonPost(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "user_id must be an uuid")
+	}
+	owner, err := app.models.Users.GetByID(userID)
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer os.Remove(f.Name())
+	return app.createUrlJson(c, owner.ID)
+}
 
-	w, err := standard.New(f.Name())
+// createUrlJson creates the url of the request body for the user userID.
+func (app *application) createUrlJson(c echo.Context, userID uuid.UUID) error {
+	urlReq := new(model.UrlCreateRequest)
+	err := bind(c, urlReq)
 	if err != nil {
-		return "", err
+		return err
 	}
+	urlReq.UserID = userID
 
-	// save file
-	if err = qrc.Save(w); err != nil {
-		fmt.Printf("could not save image: %v", err)
-		return "", err
+	urlReq.Original, err = app.validateDestination(c, urlReq.Original)
+	if err != nil {
+		return err
 	}
 
-	// upload file to bucket
-	qrLocation, err := app.storeFileInBucket(f)
+	url, err := app.models.Urls.Create(urlReq)
+	var existingErr *model.ExistingUrlError
+	if errors.As(err, &existingErr) && isV1(c) {
+		existing := urlResponse(c, &existingErr.Url)
+		return c.JSON(http.StatusConflict, apiError{Error: apiErrorBody{
+			Code:     codeConflict,
+			Message:  existingErr.Error(),
+			Existing: &existing,
+		}})
+	}
 	if err != nil {
-		fmt.Printf("could not upload file: %v", err)
-		return "", err
+		return err
 	}
 
-	return qrLocation, nil
+	return c.JSON(http.StatusCreated, urlResponse(c, &url))
 }
 
-// storeFileInBucket stores a file in a bucket.
-func (app *application) storeFileInBucket(f *os.File) (string, error) {
-	result, err := app.uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(app.config.aws.bucket),
-		Key:    aws.String(filepath.Base(f.Name())),
-		Body:   f,
-	})
+// urlResponse returns the id and the full short url of url.
+func urlResponse(c echo.Context, url *model.Url) model.UrlResponse {
+	fullUrl := genFullUrl(fmt.Sprintf(c.Scheme()+"://"+c.Request().Host), url.ShortUrl)
+	return model.UrlResponse{
+		ID:        url.ID,
+		FullUrl:   fullUrl,
+		QRCodeURL: fullUrl + "/qr",
+	}
+}
+
+func (app *application) getUrlByUserHandlerJson(c echo.Context) error {
+	user := c.Get("account").(*model.User)
+	return app.listUrlsJson(c, user.ID)
+}
+
+// myUrlsHandlerJson returns the urls of the authenticated user.
+func (app *application) myUrlsHandlerJson(c echo.Context) error {
+	user, err := app.userFromContext(c)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file, %v", err)
+		return jsonError(c, http.StatusUnauthorized, "Unauthorized")
 	}
-	return aws.StringValue(&result.Location), nil
+	return app.listUrlsJson(c, user.ID)
 }
 
-func (app *application) createUrlHandlerJsonPost(c echo.Context) error {
-	urlReq := new(model.UrlCreateRequest)
-	if err := c.Bind(urlReq); err != nil {
+// listUrlsJson sends a page of the urls of the user userID.
+func (app *application) listUrlsJson(c echo.Context, userID uuid.UUID) error {
+	// without paging parameters all urls are returned, as older clients
+	// expect. The versioned api always pages.
+	if !isV1(c) && c.QueryParam("page") == "" && c.QueryParam("page_size") == "" {
+		urls, err := app.models.Urls.GetUrlByUser(userID)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, urls)
+	}
+
+	page, pageSize, err := pagination(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	urls, total, err := app.models.Urls.GetUrlByUserPage(userID, (page-1)*pageSize, pageSize)
+	if err != nil {
 		return err
 	}
 
-	url, err := app.models.Urls.Create(urlReq)
+	setPaginationHeaders(c, page, pageSize, total)
+	return c.JSON(http.StatusOK, urls)
+}
+
+// getUrlByCodeHandlerJson returns the details and recent clicks of a url.
+func (app *application) getUrlByCodeHandlerJson(c echo.Context) error {
+	url := c.Get("url").(*model.Url)
+
+	clicks, err := app.models.Clicks.Summary(url.ID, time.Now())
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
-	return c.JSON(http.StatusCreated, model.UrlResponse{
-		ID:      url.ID,
-		FullUrl: genFullUrl(fmt.Sprintf(c.Scheme()+"://"+c.Request().Host), url.ShortUrl),
+	return c.JSON(http.StatusOK, model.UrlInfoResponse{
+		UrlByUserResponse: url.Response(),
+		FullUrl:           genFullUrl(fmt.Sprintf(c.Scheme()+"://"+c.Request().Host), url.ShortUrl),
+		DisabledReason:    url.DisabledReason,
+		Clicks:            clicks,
 	})
 }
 
-func (app *application) getUrlByUserHandlerJson(c echo.Context) error {
-	userID := c.Param("user_id")
-	userUUID, err := uuid.Parse(userID)
+// updateUrlHandlerJsonPut changes the destination and expiry of a url.
+func (app *application) updateUrlHandlerJsonPut(c echo.Context) error {
+	url := c.Get("url").(*model.Url)
+
+	urlReq := new(model.UrlUpdateRequest)
+	err := bind(c, urlReq)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return err
 	}
 
-	urls, err := app.models.Urls.GetUrlByUser(userUUID)
+	urlReq.Original, err = app.validateDestination(c, urlReq.Original)
 	if err != nil {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, urls)
+	err = app.models.Urls.Update(url, urlReq)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, urlResponse(c, url))
 }
 
 // deleteUrlHandlerPost handles the deletion of a url.
 func (app *application) deleteUrlHandlerPost(c echo.Context) error {
-	urlUUID, err := uuid.Parse(c.Param("id"))
-	if err != nil {
-		app.sessionManager.Put(c.Request().Context(), "flash_error", "Bad Request?!")
-		return app.dashboardHandler(c)
-	}
+	url := c.Get("url").(*model.Url)
 
-	err = app.models.Urls.Delete(urlUUID)
+	err := app.models.Urls.Delete(url.ID)
 	if err != nil {
 		return err
 	}
@@ -184,11 +326,11 @@ func (app *application) deleteUrlHandlerPost(c echo.Context) error {
 
 // urlHandlerJsonDelete handles the deletion of a url via json.
 func (app *application) urlHandlerJsonDelete(c echo.Context) error {
-	urlReq := app.sessionManager.Get(c.Request().Context(), "urlReq").(*model.UrlDeleteRequest)
+	url := c.Get("url").(*model.Url)
 
-	err := app.models.Urls.Delete(urlReq.ID)
+	err := app.models.Urls.Delete(url.ID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, &model.UrlDeleteResponse{
@@ -196,6 +338,44 @@ func (app *application) urlHandlerJsonDelete(c echo.Context) error {
 	})
 }
 
+// deleteUrlHandlerJson deletes the url of the path.
+func (app *application) deleteUrlHandlerJson(c echo.Context) error {
+	url := c.Get("url").(*model.Url)
+
+	err := app.models.Urls.Delete(url.ID)
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// validateDestination checks that original is safe to redirect to and
+// returns it in normalized form. Links to the host serving the request are
+// rejected in addition to the configured hosts. Rejections are of kind
+// model.ErrValidation, failures to check the url are returned as is.
+func (app *application) validateDestination(c echo.Context, original string) (string, error) {
+	u, err := app.validator.Validate(c.Request().Context(), original)
+	if err != nil {
+		// only rejections are the client's fault, not failures to check
+		if safety.IsRejection(err) {
+			return "", model.Errorf(model.ErrValidation, "%s", err)
+		}
+		return "", fmt.Errorf("validating destination: %w", err)
+	}
+	if strings.EqualFold(u.Hostname(), stripPort(c.Request().Host)) {
+		return "", model.Errorf(model.ErrValidation, "%s", safety.ErrLoop)
+	}
+	return u.String(), nil
+}
+
+// stripPort removes the port from a host, if there is any.
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
 // genFullUrl generates the full url for a given short url
 func genFullUrl(prefix, url string) string {
 	return prefix + "/s/" + url
@@ -1,16 +1,15 @@
 package main
 
 import (
+	"errors"
 	"net/http"
-	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/bueti/shrinkster/internal/model"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
-	"github.com/pascaldekloe/jwt"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // signupHandler handles the display of the signup form.
@@ -19,36 +18,28 @@ func (app *application) signupHandler(c echo.Context) error {
 }
 
 func (app *application) signupHandlerPost(c echo.Context) error {
-	name := c.FormValue("name")
-	email := c.FormValue("email")
-	password := c.FormValue("password")
-	passwordConfirm := c.FormValue("password_confirm")
-
-	emailRX := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
-	if !emailRX.MatchString(email) {
-		app.sessionManager.Put(c.Request().Context(), "flash_error", "Invalid email address.")
-		return c.Render(http.StatusBadRequest, "login.tmpl.html", app.newTemplateData(c))
-	}
-
-	if len(password) < 8 || len(password) > 72 {
-		app.sessionManager.Put(c.Request().Context(), "flash_error", "Password must be between 8 and 72 characters long.")
-		return c.Render(http.StatusBadRequest, "signup.tmpl.html", app.newTemplateData(c))
+	req := model.UserRegisterReq{
+		Name:            c.FormValue("name"),
+		Email:           c.FormValue("email"),
+		Password:        c.FormValue("password"),
+		PasswordConfirm: c.FormValue("password_confirm"),
 	}
+	// the passwords are not shown again
+	form := model.UserRegisterReq{Name: req.Name, Email: req.Email}
 
-	if password != passwordConfirm {
-		app.sessionManager.Put(c.Request().Context(), "flash_error", "Password does not match.")
-		return c.Render(http.StatusBadRequest, "signup.tmpl.html", app.newTemplateData(c))
+	if err := c.Validate(&req); err != nil {
+		return app.renderFormErrors(c, "signup.tmpl.html", form, err)
 	}
 
-	user, err := app.models.Users.Register(&model.UserRegisterReq{
-		Name:     name,
-		Email:    email,
-		Password: password,
-	})
+	user, err := app.models.Users.Register(&req)
 	if err != nil {
-		app.sessionManager.Put(c.Request().Context(), "flash_error", "Internal Server Error. Please try again later.")
+		if !errors.Is(err, model.ErrConflict) {
+			return err
+		}
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "An account with this email address already exists.")
 		data := app.newTemplateData(c)
-		return c.Render(http.StatusBadRequest, "signup.tmpl.html", data)
+		data.Form = form
+		return c.Render(http.StatusConflict, "signup.tmpl.html", data)
 	}
 
 	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, model.ScopeActivation)
@@ -67,34 +58,45 @@ func (app *application) signupHandlerPost(c echo.Context) error {
 
 func (app *application) signupHandlerJsonPost(c echo.Context) error {
 	var body model.UserRegisterReq
-	if err := c.Bind(&body); err != nil {
-		return c.JSON(http.StatusBadRequest, err)
+	if err := bind(c, &body); err != nil {
+		return err
 	}
 
 	userResponse, err := app.models.Users.Register(&body)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
-		//// why can I not use gorm.ErrDuplicatedKey here?
-		//if resp.Error() == "ERROR: duplicate key value violates unique constraint \"idx_users_email\" (SQLSTATE 23505)" {
-		//	return c.JSON(http.StatusBadRequest, "email already exists")
-		//} else {
-		//	return c.JSON(http.StatusInternalServerError, resp.Error())
-		//}
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, userResponse)
 }
 
 func (app *application) loginHandlerPost(c echo.Context) error {
-	email := c.FormValue("email")
-	password := c.FormValue("password")
+	req := model.UserLoginRequest{
+		Email:    c.FormValue("email"),
+		Password: c.FormValue("password"),
+	}
+	form := model.UserLoginRequest{Email: req.Email}
 
-	user, err := app.models.Users.Login(email, password)
+	if ok, wait := app.loginThrottle.Allow(c.RealIP()); !ok {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		app.sessionManager.Put(c.Request().Context(), "flash_error", "Too many failed login attempts. Please try again later.")
+		data := app.newTemplateData(c)
+		return c.Render(http.StatusTooManyRequests, "login.tmpl.html", data)
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return app.renderFormErrors(c, "login.tmpl.html", form, err)
+	}
+
+	user, err := app.models.Users.Login(req.Email, req.Password)
 	if err != nil {
+		app.notifyLockout(req.Email, err)
 		app.sessionManager.Put(c.Request().Context(), "flash_error", "Login failed. Please check your username and password and try again.")
 		data := app.newTemplateData(c)
+		data.Form = form
 		return c.Render(http.StatusUnauthorized, "login.tmpl.html", data)
 	}
+	app.loginThrottle.Succeed(c.RealIP())
 	if !user.Activated {
 		app.sessionManager.Put(c.Request().Context(), "flash_error", "Your user account has not been activated. Please check your mailbox for the activation link.")
 		data := app.newTemplateData(c)
@@ -111,62 +113,39 @@ func (app *application) loginHandlerPost(c echo.Context) error {
 
 func (app *application) loginHandlerJsonPost(c echo.Context) error {
 	var body model.UserLoginRequest
-	if err := c.Bind(&body); err != nil {
-		return c.JSON(http.StatusBadRequest, err)
+	if err := bind(c, &body); err != nil {
+		return err
 	}
 
-	user, err := app.models.Users.Login(body.Email, body.Password)
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, err)
+	if ok, wait := app.loginThrottle.Allow(c.RealIP()); !ok {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		return jsonError(c, http.StatusTooManyRequests, "too many failed login attempts")
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password))
+	user, err := app.models.Users.Login(body.Email, body.Password)
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, "invalid credentials")
+		app.notifyLockout(body.Email, err)
+		return jsonError(c, http.StatusUnauthorized, "invalid credentials")
 	}
+	app.loginThrottle.Succeed(c.RealIP())
 
-	var claims jwt.Claims
-	claims.Subject = user.ID.String()
-	claims.Issued = jwt.NewNumericTime(time.Now())
-	claims.NotBefore = jwt.NewNumericTime(time.Now())
-	claims.Expires = jwt.NewNumericTime(time.Now().Add(24 * time.Hour))
-	claims.Issuer = "shrink.ch"
-	claims.Audiences = []string{"shrink.ch"}
-
-	jwtBytes, err := claims.HMACSign(jwt.HS256, []byte(app.config.signingKey))
+	token, err := app.newAuthToken(user)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+		return err
 	}
 
 	userLoginResponse := model.UserLoginResponse{
 		ID:    user.ID,
 		Email: user.Email,
-		Token: string(jwtBytes),
+		Token: token,
 	}
 
 	return c.JSON(http.StatusOK, userLoginResponse)
 }
 
 func (app *application) getUserHandlerJson(c echo.Context) error {
-
-	idStr := c.Param("id")
-	id, err := uuid.Parse(idStr)
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, err)
-	}
-
-	user, err := app.models.Users.GetByID(id)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
-	}
-
-	return c.JSON(http.StatusOK, model.UserResponse{
-		ID:        user.ID,
-		Name:      user.Name,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-	})
+	user := c.Get("account").(*model.User)
+	return c.JSON(http.StatusOK, user.Response())
 }
 
 // activateUserHandler handles the activation of a user.
@@ -174,7 +153,7 @@ func (app *application) activateUserHandler(c echo.Context) error {
 	token := c.QueryParam("token")
 	err := model.ValidateTokenPlaintext(token)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return jsonError(c, http.StatusBadRequest, err.Error())
 	}
 
 	userID, err := app.models.Tokens.GetUserID(model.ScopeActivation, token)
@@ -193,29 +172,31 @@ func (app *application) activateUserHandler(c echo.Context) error {
 	return c.Render(http.StatusOK, "home.tmpl.html", data)
 }
 
+// activationRequest is the body of the json activation.
+type activationRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
 // activateUserHandlerJson handles the activation of a user with json.
 func (app *application) activateUserHandlerJson(c echo.Context) error {
-	req := struct {
-		Token string `json:"token"`
-	}{}
-
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, err)
+	var req activationRequest
+	if err := bind(c, &req); err != nil {
+		return err
 	}
 
 	err := model.ValidateTokenPlaintext(req.Token)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return jsonError(c, http.StatusBadRequest, err.Error())
 	}
 
 	userID, err := app.models.Tokens.GetUserID(model.ScopeActivation, req.Token)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return err
 	}
 
 	err = app.models.Users.Activate(userID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, "Your account has been activated successfully. Please log in.")
@@ -228,8 +209,12 @@ func (app *application) resendActivationLinkHandler(c echo.Context) error {
 
 // resendActivationLinkHandlerPost handles the resending of an activation link.
 func (app *application) resendActivationLinkHandlerPost(c echo.Context) error {
-	email := c.FormValue("email")
-	user, err := app.models.Users.GetByEmail(email)
+	req := model.PasswordResetRequest{Email: c.FormValue("email")}
+	if err := c.Validate(&req); err != nil {
+		return app.renderFormErrors(c, "resend_activation_link.tmpl.html", req, err)
+	}
+
+	user, err := app.models.Users.GetByEmail(req.Email)
 	if err != nil {
 		app.sessionManager.Put(c.Request().Context(), "flash_error", "No user exists with this email address.")
 		data := app.newTemplateData(c)
@@ -253,21 +238,21 @@ func (app *application) resendActivationLinkHandlerPost(c echo.Context) error {
 // resendActivationLinkHandlerJsonPost handles the resending of an activation link with json.
 func (app *application) resendActivationLinkHandlerJsonPost(c echo.Context) error {
 	body := struct {
-		Email string `json:"email"`
+		Email string `json:"email" validate:"required,email"`
 	}{}
 
-	if err := c.Bind(&body); err != nil {
-		return c.JSON(http.StatusBadRequest, err)
+	if err := bind(c, &body); err != nil {
+		return err
 	}
 
 	user, err := app.models.Users.GetByEmail(body.Email)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, err)
+		return err
 	}
 
 	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, model.ScopeActivation)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+		return err
 	}
 
 	sendActivationEmail(token, user, app)
@@ -278,9 +263,22 @@ func (app *application) resendActivationLinkHandlerJsonPost(c echo.Context) erro
 func (app *application) listUsersHandlerJson(c echo.Context) error {
 	users, err := app.models.Users.List()
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
-	return c.JSON(http.StatusOK, users)
+	responses := make([]model.UserResponse, len(users))
+	for i := range users {
+		responses[i] = users[i].Response()
+	}
+	return c.JSON(http.StatusOK, responses)
+}
+
+// meHandlerJson returns the authenticated user.
+func (app *application) meHandlerJson(c echo.Context) error {
+	user, err := app.userFromContext(c)
+	if err != nil {
+		return jsonError(c, http.StatusUnauthorized, "Unauthorized")
+	}
+	return c.JSON(http.StatusOK, user.Response())
 }
 
 // loginHandler handles the display of the login form.
@@ -296,21 +294,68 @@ func (app *application) logoutHandlerPost(c echo.Context) error {
 	}
 
 	app.sessionManager.Remove(c.Request().Context(), "authenticated")
-	c.Set("user", nil)
+	model.SetContextUser(c, nil)
 	app.sessionManager.Put(c.Request().Context(), "flash", "You've been logged out successfully!")
 	return c.Render(http.StatusOK, "home.tmpl.html", app.newTemplateData(c))
 }
 
+// unlockUserHandlerJsonPost allows an admin to unlock a locked user account.
+func (app *application) unlockUserHandlerJsonPost(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	err = app.models.Users.Unlock(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, "The user account has been unlocked.")
+}
+
+// notifyLockout notifies the account owner if a failed login locked the
+// account. The attempt has been counted against the client IP by
+// loginThrottle.Allow already.
+func (app *application) notifyLockout(email string, err error) {
+	var credErr *model.CredentialsError
+	if !errors.As(err, &credErr) || credErr.LockedUntil == nil {
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(email)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	sendLockoutEmail(user, *credErr.LockedUntil, app)
+}
+
+func sendLockoutEmail(user *model.User, until time.Time, app *application) {
+	app.enqueueEmail(user.Email, "account_locked.tmpl.html", map[string]any{
+		"name":  user.Name,
+		"until": until.UTC().Format("02 Jan 2006 at 15:04 MST"),
+	})
+}
+
 func sendActivationEmail(token *model.Token, user *model.User, app *application) {
-	go func() {
-		data := map[string]any{
-			"activationToken": token.Plaintext,
-			"userID":          user.ID,
-		}
+	app.enqueueEmail(user.Email, "welcome.tmpl.html", map[string]any{
+		"activationToken": token.Plaintext,
+		"userID":          user.ID,
+	})
+}
 
-		err := app.mailer.Send(user.Email, "welcome.tmpl.html", data)
-		if err != nil {
-			log.Error(err)
-		}
-	}()
+func sendPasswordResetEmail(token *model.Token, user *model.User, app *application) {
+	app.enqueueEmail(user.Email, "password_reset.tmpl.html", map[string]any{
+		"name":       user.Name,
+		"resetToken": token.Plaintext,
+	})
+}
+
+func sendEmailChangeEmail(token *model.Token, user *model.User, app *application) {
+	app.enqueueEmail(user.PendingEmail, "email_change.tmpl.html", map[string]any{
+		"name":              user.Name,
+		"email":             user.PendingEmail,
+		"confirmationToken": token.Plaintext,
+	})
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// requestValidator checks requests against their validate tags. It is the
+// echo.Validator of the app, used by the form and the json handlers.
+type requestValidator struct {
+	validate *validator.Validate
+}
+
+func newRequestValidator() *requestValidator {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	// report fields by the names used in forms and json
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return &requestValidator{validate: v}
+}
+
+// Validate returns model.FieldErrors if i doesn't satisfy its validate tags.
+func (v *requestValidator) Validate(i any) error {
+	err := v.validate.Struct(i)
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+
+	fields := model.FieldErrors{}
+	for _, e := range errs {
+		if _, ok := fields[e.Field()]; !ok {
+			fields[e.Field()] = validationMessage(e)
+		}
+	}
+	return fields
+}
+
+// validationMessage describes a failed validation, it is meant to follow the field name.
+func validationMessage(e validator.FieldError) string {
+	switch e.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "url":
+		return "must be a valid URL"
+	case "fqdn":
+		return "must be a domain name"
+	case "alphanum":
+		return "may only contain letters and digits"
+	case "min":
+		return "must be at least " + e.Param() + " characters long"
+	case "max":
+		return "must be at most " + e.Param() + " characters long"
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(e.Param(), " ", ", ")
+	case "eqfield":
+		return "does not match"
+	}
+	return "is invalid"
+}
+
+// bind reads the request body into req and validates it.
+func bind(c echo.Context, req any) error {
+	err := c.Bind(req)
+	if err != nil {
+		return err
+	}
+	return c.Validate(req)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bueti/shrinkster/shrink"
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+// showInfo prints the details and recent visits of a url.
+func (app *application) showInfo(context *cli.Context) error {
+	if context.NArg() != 1 {
+		return usageError("expected exactly one argument: the id, code or short url")
+	}
+
+	code, err := app.resolveShortCode(context.Context, context.Args().First())
+	if err != nil {
+		return err
+	}
+
+	err = app.useToken()
+	if err != nil {
+		return err
+	}
+
+	info, err := app.client.GetURL(context.Context, code)
+	if err != nil {
+		return apiError("getting url", err)
+	}
+
+	status := "active"
+	switch {
+	case info.Disabled:
+		status = "disabled"
+		if info.DisabledReason != "" {
+			status += ": " + info.DisabledReason
+		}
+	case info.ExpiresAt != nil && info.ExpiresAt.Before(time.Now()):
+		status = "expired"
+	}
+
+	r := result{
+		Value:  info,
+		Header: []string{"FIELD", "VALUE"},
+		Rows: [][]string{
+			{"ID", info.ID.String()},
+			{"Short URL", info.FullURL},
+			{"Original", info.Original},
+			{"Status", status},
+			{"Visits", strconv.Itoa(info.Visits)},
+			{"Last 24 hours", strconv.Itoa(info.Clicks.Last24h)},
+			{"Last 7 days", strconv.Itoa(info.Clicks.Last7d)},
+			{"Last 30 days", strconv.Itoa(info.Clicks.Last30d)},
+			{"Last visit", formatTime(info.Clicks.LastClickAt)},
+			{"Expires", formatTime(info.ExpiresAt)},
+			{"Created", formatTime(&info.CreatedAt)},
+			{"QR code", info.FullURL + "/qr"},
+		},
+		Quiet: []string{info.FullURL},
+	}
+	return app.print(r)
+}
+
+// delete deletes the urls given as arguments or matching --filter.
+func (app *application) delete(context *cli.Context) error {
+	args := context.Args().Slice()
+	if id := context.String("id"); id != "" {
+		args = append(args, id)
+	}
+	filter := context.String("filter")
+	if len(args) == 0 && filter == "" {
+		return usageError("expected the urls to delete as arguments or --filter")
+	}
+
+	err := app.useToken()
+	if err != nil {
+		return err
+	}
+
+	targets, err := app.deleteTargets(context.Context, args, filter)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return withCode(exitNotFound, fmt.Errorf("no urls match %q", filter))
+	}
+
+	r := result{Header: []string{"ID", "SHORT", "ORIGINAL", "STATUS"}}
+	type deleteResponse struct {
+		ID       uuid.UUID `json:"id"`
+		Short    string    `json:"short_url"`
+		Original string    `json:"original"`
+		Deleted  bool      `json:"deleted"`
+		Error    string    `json:"error,omitempty"`
+	}
+	var deleted []deleteResponse
+
+	if context.Bool("dry-run") {
+		for _, link := range targets {
+			deleted = append(deleted, deleteResponse{ID: link.ID, Short: link.ShortCode, Original: link.Original})
+			r.Rows = append(r.Rows, []string{link.ID.String(), link.ShortCode, link.Original, "would be deleted"})
+			r.Quiet = append(r.Quiet, link.ID.String())
+		}
+		r.Value = deleted
+		return app.print(r)
+	}
+
+	if !context.Bool("yes") {
+		ok, err := confirmDelete(targets, filter != "")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			app.info("Nothing deleted")
+			return nil
+		}
+	}
+
+	var failed []error
+	for _, link := range targets {
+		resp := deleteResponse{ID: link.ID, Short: link.ShortCode, Original: link.Original, Deleted: true}
+		status := "deleted"
+		err := app.client.DeleteURL(context.Context, link.ID)
+		if err != nil {
+			err = apiError("deleting "+link.ShortCode, err)
+			failed = append(failed, err)
+			resp.Deleted = false
+			resp.Error = err.Error()
+			status = "error: " + err.Error()
+		} else {
+			r.Quiet = append(r.Quiet, link.ID.String())
+		}
+		deleted = append(deleted, resp)
+		r.Rows = append(r.Rows, []string{link.ID.String(), link.ShortCode, link.Original, status})
+	}
+	r.Value = deleted
+
+	err = app.print(r)
+	if err != nil {
+		return err
+	}
+
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	default:
+		return withCode(exitError, fmt.Errorf("%d of %d urls could not be deleted", len(failed), len(targets)))
+	}
+}
+
+// deleteTargets resolves ids, codes and short urls and adds the urls
+// matching filter. Every url is returned once.
+func (app *application) deleteTargets(ctx context.Context, args []string, filter string) ([]shrink.URL, error) {
+	var (
+		targets []shrink.URL
+		seen    = map[uuid.UUID]bool{}
+	)
+	add := func(link shrink.URL) {
+		if !seen[link.ID] {
+			seen[link.ID] = true
+			targets = append(targets, link)
+		}
+	}
+
+	for _, arg := range args {
+		if id, err := uuid.Parse(arg); err == nil {
+			link, err := app.findByID(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			add(*link)
+			continue
+		}
+
+		info, err := app.client.GetURL(ctx, shortCodeFromInput(arg))
+		if err != nil {
+			return nil, apiError("looking up "+arg, err)
+		}
+		add(info.URL)
+	}
+
+	if filter != "" {
+		links, err := app.userLinks(ctx)
+		if err != nil {
+			return nil, err
+		}
+		filter = strings.ToLower(filter)
+		for _, link := range links {
+			if strings.Contains(strings.ToLower(link.ShortCode), filter) || strings.Contains(strings.ToLower(link.Original), filter) {
+				add(link)
+			}
+		}
+	}
+
+	return targets, nil
+}
+
+// confirmDelete lists the urls and asks whether to delete them. Without a
+// terminal nothing is asked, except for filters which could match more than intended.
+func confirmDelete(targets []shrink.URL, filtered bool) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		if filtered {
+			return false, usageError("deleting with --filter needs --yes when not run in a terminal")
+		}
+		return true, nil
+	}
+
+	for _, link := range targets {
+		fmt.Fprintf(os.Stderr, "  %s  %s\n", link.ShortCode, link.Original)
+	}
+	fmt.Fprintf(os.Stderr, "Delete %d url(s)? [y/N] ", len(targets))
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// userLinks returns all urls of the logged in user. They are fetched once
+// and cached.
+func (app *application) userLinks(ctx context.Context) ([]shrink.URL, error) {
+	if app.links != nil {
+		return app.links, nil
+	}
+
+	if _, err := uuid.Parse(app.profile.ID); err != nil {
+		return nil, withCode(exitAuth, fmt.Errorf("no account in profile %s, please login first", app.profileName))
+	}
+
+	links := []shrink.URL{}
+	it := app.client.MyURLs(ctx, 100)
+	for it.Next() {
+		links = append(links, it.URL())
+	}
+	if err := it.Err(); err != nil {
+		return nil, apiError("listing urls", err)
+	}
+
+	app.links = links
+	return links, nil
+}
+
+// findByID returns the url of the logged in user with the given id.
+func (app *application) findByID(ctx context.Context, id uuid.UUID) (*shrink.URL, error) {
+	links, err := app.userLinks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range links {
+		if links[i].ID == id {
+			return &links[i], nil
+		}
+	}
+	return nil, withCode(exitNotFound, fmt.Errorf("no url with id %s found", id))
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bueti/shrinkster/internal/config"
+	"github.com/bueti/shrinkster/shrink"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+// login to shrinkster, either with the device flow or with a password
+func (app *application) login(context *cli.Context) error {
+	var (
+		userResp *shrink.LoginResponse
+		err      error
+	)
+
+	if context.String("username") != "" {
+		userResp, err = app.passwordLogin(context)
+	} else {
+		userResp, err = app.deviceLogin(context.Context)
+	}
+	if err != nil {
+		return err
+	}
+
+	// a new account gets its own keyring entry, so the same email can be
+	// used on several servers
+	if app.profile.Email != userResp.Email || app.profile.KeyringKey == "" {
+		app.profile.KeyringKey = app.profileName + ":" + userResp.Email
+	}
+	app.profile.Email = userResp.Email
+	app.profile.ID = userResp.ID.String()
+
+	err = app.setToken(userResp.Token)
+	if err != nil {
+		app.logger.Error("failed to set token in keyring: %s", err)
+		return err
+	}
+
+	// store the account in the profile
+	err = config.Save(app.cfg)
+	if err != nil {
+		app.logger.Error("failed to save profile in config: %s", err)
+		return err
+	}
+
+	app.info("Logged in as %s (profile %s)", userResp.Email, app.profileName)
+	return nil
+}
+
+// passwordLogin logs in with email and password. The password is read from
+// the terminal without echo unless it was given on the command line.
+func (app *application) passwordLogin(context *cli.Context) (*shrink.LoginResponse, error) {
+	email := context.String("username")
+	password := context.String("password")
+
+	if password == "" {
+		var err error
+		password, err = readPassword("Password: ")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	userResp, err := app.client.Login(context.Context, email, password)
+	if err != nil {
+		return nil, apiError("login", err)
+	}
+	return userResp, nil
+}
+
+// deviceLogin runs the device authorization flow: the user approves the
+// shown code in the browser while the CLI polls for the token.
+func (app *application) deviceLogin(ctx context.Context) (*shrink.LoginResponse, error) {
+	deviceResp, err := app.client.RequestDeviceCode(ctx)
+	if err != nil {
+		return nil, apiError("login", err)
+	}
+
+	// the instructions are needed even in quiet mode
+	fmt.Fprintf(os.Stderr, "Open %s in your browser and enter the code %s\n", deviceResp.VerificationURI, deviceResp.UserCode)
+	fmt.Fprintf(os.Stderr, "or go directly to %s\n", deviceResp.VerificationURIComplete)
+	fmt.Fprintln(os.Stderr, "Waiting for approval...")
+
+	userResp, err := app.client.WaitForDeviceToken(ctx, deviceResp)
+	var apiErr *shrink.APIError
+	switch {
+	case err == nil:
+		return userResp, nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return nil, fmt.Errorf("login failed: the code has expired, please try again")
+	case !errors.As(err, &apiErr):
+		return nil, fmt.Errorf("login failed: %w", err)
+	case apiErr.Code == shrink.ErrCodeAccessDenied:
+		return nil, withCode(exitAuth, fmt.Errorf("login failed: the device was denied access"))
+	case apiErr.Code == shrink.ErrCodeExpiredToken:
+		return nil, fmt.Errorf("login failed: the code has expired, please try again")
+	default:
+		return nil, apiError("login", err)
+	}
+}
+
+// readPassword prompts for a password on stderr and reads it without echo.
+func readPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("no terminal available to read the password, use the device login instead")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(password), nil
+}
@@ -1,18 +1,13 @@
 package main
 
 import (
-	"bytes"
-	"crypto/tls"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/bueti/shrinkster/internal/config"
-	"github.com/bueti/shrinkster/internal/model"
-	"github.com/bueti/shrinkster/internal/shrink"
+	"github.com/bueti/shrinkster/shrink"
 	"github.com/charmbracelet/log"
 	"github.com/google/uuid"
 	"github.com/urfave/cli/v2"
@@ -30,6 +25,13 @@ type application struct {
 	cli    *cli.App
 	cfg    config.Config
 	logger log.Logger
+	output string
+	quiet  bool
+	// profile is the selected profile, see selectProfile
+	profileName string
+	profile     *config.Profile
+	// links caches the urls of the user, see userLinks
+	links []shrink.URL
 }
 
 func main() {
@@ -42,16 +44,12 @@ func main() {
 	c := shrink.NewClient("")
 	if os.Getenv("DEBUG") == "true" {
 		logger.SetLevel(log.DebugLevel)
-		c.Host = "https://localhost:8080"
-		c.HttpClient.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
 		c.HttpClient.Timeout = 0
 	}
 
 	cfg, err := config.Load()
 	if err != nil {
-		logger.Debug("no configuration found", err)
+		logger.Warn("failed to load configuration", "err", err)
 	}
 
 	app := &application{
@@ -62,22 +60,61 @@ func main() {
 
 	app.cli = &cli.App{
 		Name:        config.AppName,
-		Description: "Shrinkster (shrink.ch) is a URL shortener written in Go.",
+		Usage:       "Shorten URLs with shrink.ch",
+		UsageText:   "shrinkster [global options] <url>...\ncommand | shrinkster [global options]\nshrinkster [global options] --clipboard\nshrinkster [global options] command [command options] [arguments...]",
+		Description: "Shrinkster (shrink.ch) is a URL shortener written in Go.\nURLs given as arguments, one per line on stdin or in the clipboard are shortened right away. If you shortened an URL before, the existing short URL is returned.",
+		Action:      app.shorten,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "clipboard",
+				Aliases: []string{"c"},
+				Usage:   "Shorten the URL in the clipboard and copy the short URL back",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Value:   outputTable,
+				Usage:   "Output format: table, json, yaml or csv",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Only print IDs or short URLs",
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Aliases: []string{"p"},
+				EnvVars: []string{"SHRINKSTER_PROFILE"},
+				Usage:   "The profile to use, see 'shrinkster profile'. DEBUG=true selects the built-in local profile for https://localhost:8080",
+			},
+		},
+		Before: func(context *cli.Context) error {
+			err := app.checkOutput(context)
+			if err != nil {
+				return err
+			}
+			return app.selectProfile(context)
+		},
+		OnUsageError: func(context *cli.Context, err error, isSubcommand bool) error {
+			return withCode(exitUsage, err)
+		},
 		Commands: []*cli.Command{
 			{
-				Name:   "login",
-				Usage:  "Login to Shrinkster",
-				Action: app.login,
+				Name:        "login",
+				Usage:       "Login to Shrinkster",
+				Description: "Without flags, login opens a device authorization flow which you approve in the browser.\nWith --username, you are prompted for your password instead.",
+				Action:      app.login,
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:  "username",
 						Value: "",
-						Usage: "Your shrink.ch username",
+						Usage: "Your shrink.ch username, prompts for the password",
 					},
 					&cli.StringFlag{
-						Name:  "password",
-						Value: "",
-						Usage: "Your shrink.ch password",
+						Name:   "password",
+						Value:  "",
+						Usage:  "Your shrink.ch password, deprecated: it ends up in your shell history",
+						Hidden: true,
 					},
 				},
 			},
@@ -88,34 +125,171 @@ func main() {
 				Action:  app.list,
 			},
 			{
-				Name:    "create",
-				Aliases: []string{"c"},
-				Usage:   "Create a new URL",
-				Action:  app.create,
+				Name:      "create",
+				Aliases:   []string{"c"},
+				Usage:     "Create a new URL",
+				ArgsUsage: "<url>",
+				Action:    app.create,
 				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:     "original",
-						Value:    "",
-						Usage:    "The original URL",
-						Required: true,
+						Name:  "original",
+						Value: "",
+						Usage: "The original URL, can also be given as argument",
 					},
 					&cli.StringFlag{
 						Name:  "short_code",
 						Value: "",
 						Usage: "The short code for the URL",
 					},
+					&cli.StringFlag{
+						Name:  "qr-out",
+						Value: "",
+						Usage: "Write the QR code of the new URL to this file (.png or .svg)",
+					},
 				},
 			},
 			{
-				Name:    "delete",
-				Aliases: []string{"d"},
-				Usage:   "Delete an URL",
-				Action:  app.delete,
+				Name:      "qr",
+				Usage:     "Get the QR code of an URL",
+				ArgsUsage: "<id|code|short url>",
+				Action:    app.qrCode,
 				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:  "id",
+						Name:    "file",
+						Aliases: []string{"f"},
+						Value:   "",
+						Usage:   "Write the QR code to this file instead of printing it",
+					},
+					&cli.StringFlag{
+						Name:  "format",
 						Value: "",
-						Usage: "The ID of the URL to delete",
+						Usage: "Image format, png or svg (default: from the file extension)",
+					},
+					&cli.IntFlag{
+						Name:  "size",
+						Value: 512,
+						Usage: "Image size in pixels",
+					},
+					&cli.BoolFlag{
+						Name:  "invert",
+						Usage: "Invert the terminal output for light backgrounds",
+					},
+				},
+			},
+			{
+				Name:      "info",
+				Aliases:   []string{"i"},
+				Usage:     "Show the details and recent visits of an URL",
+				ArgsUsage: "<id|code|short url>",
+				Action:    app.showInfo,
+			},
+			{
+				Name:      "stats",
+				Usage:     "Show the visits of an URL over time",
+				ArgsUsage: "<id|code|short url>",
+				Action:    app.stats,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "since",
+						Value: "",
+						Usage: "Start of the period: a date, a timestamp or a duration like 7d (default: 30 days before --until)",
+					},
+					&cli.StringFlag{
+						Name:  "until",
+						Value: "",
+						Usage: "End of the period: a date, a timestamp or a duration like 1d (default: now)",
+					},
+					&cli.StringFlag{
+						Name:  "interval",
+						Value: "day",
+						Usage: "Group visits by hour, day, week or month",
+					},
+				},
+			},
+			{
+				Name:        "delete",
+				Aliases:     []string{"d"},
+				Usage:       "Delete URLs",
+				ArgsUsage:   "<id|code|short url>...",
+				Description: "Deletes the given URLs or all URLs matching --filter. In a terminal, you are asked for confirmation unless --yes is given.",
+				Action:      app.delete,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:   "id",
+						Value:  "",
+						Usage:  "The ID of the URL to delete",
+						Hidden: true,
+					},
+					&cli.StringFlag{
+						Name:  "filter",
+						Value: "",
+						Usage: "Delete all URLs whose code or original URL contains this text",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Only show which URLs would be deleted",
+					},
+					&cli.BoolFlag{
+						Name:    "yes",
+						Aliases: []string{"y"},
+						Usage:   "Don't ask for confirmation",
+					},
+				},
+			},
+			{
+				Name:        "tui",
+				Usage:       "Browse and manage your URLs interactively",
+				Description: "Filter with /, copy the short URL with enter, create with n, edit with e, delete with d and show the QR code with v.",
+				Action:      app.tui,
+			},
+			{
+				Name:  "profile",
+				Usage: "Manage profiles for multiple servers and accounts",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "add",
+						Usage:     "Add a profile or update its server settings",
+						ArgsUsage: "[--host URL] <name>",
+						Action:    app.profileAdd,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "host",
+								Value: config.DefaultHost,
+								Usage: "The URL of the Shrinkster server",
+							},
+							&cli.BoolFlag{
+								Name:  "insecure",
+								Usage: "Don't verify the TLS certificate of the server",
+							},
+							&cli.StringFlag{
+								Name:  "ca-cert",
+								Value: "",
+								Usage: "PEM file with a CA certificate to trust",
+							},
+							&cli.BoolFlag{
+								Name:  "use",
+								Usage: "Make this the current profile",
+							},
+						},
+					},
+					{
+						Name:    "list",
+						Aliases: []string{"ls"},
+						Usage:   "List profiles",
+						Action:  app.profileList,
+					},
+					{
+						Name:      "use",
+						Usage:     "Set the current profile",
+						ArgsUsage: "<name>",
+						Action:    app.profileUse,
+					},
+					{
+						Name:      "remove",
+						Aliases:   []string{"rm"},
+						Usage:     "Remove a profile and its token",
+						ArgsUsage: "<name>",
+						Action:    app.profileRemove,
 					},
 				},
 			},
@@ -129,214 +303,116 @@ func main() {
 	}
 
 	if err := app.cli.Run(os.Args); err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
 	}
 }
 
 // list all urls from the logged in user
 func (app *application) list(context *cli.Context) error {
-	fmt.Println("List URLs")
-
-	token, err := app.getToken(app.cfg.Email)
+	token, err := app.getToken()
 	if err != nil {
-		app.logger.Error("failed to get token", err)
 		return err
 	}
-
 	app.client.Token = token
 
-	var urlReq model.UrlByUserRequest
-	urlReq.ID = app.cfg.ID
-
-	marshalled, err := json.Marshal(urlReq)
-	if err != nil {
-		app.logger.Error("failed to marshall", err)
-		return err
-	}
-
-	res, err := app.client.DoRequest("GET", fmt.Sprintf("/api/urls/%s", app.cfg.ID), bytes.NewReader(marshalled))
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	// check the response
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("login failed: %s", res.Status)
-	}
-
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		app.logger.Error("failed to read all body of response: %s", err)
-		return err
-	}
-
-	var urlsResp []model.UrlByUserResponse
-	err = json.Unmarshal(resBody, &urlsResp)
-	if err != nil {
-		app.logger.Error("failed to unmarshall response: %s", err)
-		return err
+	if _, err := uuid.Parse(app.profile.ID); err != nil {
+		return withCode(exitAuth, fmt.Errorf("no account in profile %s, please login first", app.profileName))
 	}
 
-	fmt.Println("ID\t\t\t\t\tShort\t\tVisits\tOriginal")
-	for _, url := range urlsResp {
-		fmt.Println(fmt.Sprintf("- %s\t%s\t%d\t%s", url.ID, url.ShortUrl, url.Visits, url.Original))
+	urls := []shrink.URL{}
+	it := app.client.MyURLs(context.Context, 100)
+	for it.Next() {
+		urls = append(urls, it.URL())
 	}
-	return nil
-
-}
-
-// login to shrinkster
-func (app *application) login(context *cli.Context) error {
-	fmt.Println("Logging in to Shrinkster...")
-
-	var userReq model.UserLoginRequest
-	userReq.Email = context.String("username")
-	userReq.Password = context.String("password")
-
-	marshalled, err := json.Marshal(userReq)
-	if err != nil {
-		app.logger.Error("failed to marshall", err)
-		return err
+	if err := it.Err(); err != nil {
+		return apiError("listing urls", err)
 	}
 
-	// create a new POST request with username and password
-	res, err := app.client.DoRequest("POST", "/api/login", bytes.NewReader(marshalled))
-	if err != nil {
-		return err
+	r := result{
+		Value:  urls,
+		Header: []string{"ID", "SHORT", "VISITS", "ORIGINAL"},
 	}
-
-	defer res.Body.Close()
-
-	// check the response
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("login failed: %s", res.Status)
+	for _, url := range urls {
+		r.Rows = append(r.Rows, []string{url.ID.String(), url.ShortCode, strconv.Itoa(url.Visits), url.Original})
+		r.Quiet = append(r.Quiet, url.ID.String())
 	}
-
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		app.logger.Error("failed to read body of response: %s", err)
-		return err
-	}
-
-	var userResp model.UserLoginResponse
-	err = json.Unmarshal(resBody, &userResp)
-	if err != nil {
-		app.logger.Error("failed to unmarshall response: %s", err)
-		return err
-	}
-
-	// store the username
-	err = config.Save(userResp)
-	if err != nil {
-		app.logger.Error("failed to set username in config: %s", err)
-		return err
-	}
-
-	err = app.setToken(context, userResp)
-	if err != nil {
-		app.logger.Error("failed to set token in keyring: %s", err)
-		return err
-	}
-
-	return nil
+	return app.print(r)
 }
 
 // create creates a new url and returns the short url
 func (app *application) create(context *cli.Context) error {
-	var urlReq model.UrlCreateRequest
-	urlReq.Original = context.String("original")
-	urlReq.ShortCode = context.String("short_code")
-	urlReq.UserID = app.cfg.ID
-
-	marshalled, err := json.Marshal(urlReq)
-	if err != nil {
-		app.logger.Error("failed to marshall", err)
-		return err
-	}
-
-	token, err := app.getToken(app.cfg.Email)
-	app.client.Token = token
-
-	res, err := app.client.DoRequest("POST", "/api/urls", bytes.NewReader(marshalled))
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	// check the response
-	if res.StatusCode != http.StatusCreated {
-		return fmt.Errorf("login failed: %s", res.Status)
+	original := context.String("original")
+	switch {
+	case original != "" && context.NArg() > 0:
+		return usageError("give the url either with --original or as argument")
+	case original == "" && context.NArg() != 1:
+		return usageError("expected exactly one argument: the url to shorten")
+	case original == "":
+		original = context.Args().First()
 	}
 
-	resBody, err := io.ReadAll(res.Body)
+	err := app.useToken()
 	if err != nil {
 		return err
 	}
 
-	var urlResp model.UrlResponse
-	err = json.Unmarshal(resBody, &urlResp)
-	if err != nil {
-		return err
-	}
-
-	fmt.Println(urlResp.FullUrl)
-	return nil
-}
-
-// delete an existing url
-func (app *application) delete(context *cli.Context) error {
-	var (
-		err    error
-		urlReq model.UrlDeleteRequest
-	)
-
-	urlReq.ID, err = uuid.Parse(context.String("id"))
-	if err != nil {
-		return fmt.Errorf("failed to parse id: %s", err)
-	}
-
-	marshalled, err := json.Marshal(urlReq)
+	urlResp, err := app.createOrExisting(context.Context, shrink.CreateURLRequest{
+		Original:  original,
+		ShortCode: context.String("short_code"),
+	})
 	if err != nil {
-		app.logger.Error("failed to marshall", err)
 		return err
 	}
-
-	token, err := app.getToken(app.cfg.Email)
-	app.client.Token = token
-
-	res, err := app.client.DoRequest("DELETE", "/api/urls", bytes.NewReader(marshalled))
-	if err != nil {
-		app.logger.Error("failed to delete url", err.Error())
-		return err
+	if urlResp.Existing {
+		app.info("%s was already shortened", original)
 	}
-	defer res.Body.Close()
 
-	// check the response
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("deletion failed: %s", res.Status)
+	if out := context.String("qr-out"); out != "" {
+		err = app.saveQRCode(context.Context, shortCodeFromInput(urlResp.FullURL), out, formatFromFilename(out), 512)
+		if err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return app.print(result{
+		Value:  urlResp,
+		Header: []string{"ID", "SHORT URL"},
+		Rows:   [][]string{{urlResp.ID, urlResp.FullURL}},
+		Quiet:  []string{urlResp.FullURL},
+	})
 }
 
-func (app *application) setToken(context *cli.Context, userResp model.UserLoginResponse) error {
-	if err := keyring.Set("shrinkster", context.String("username"), userResp.Token); err != nil {
+// setToken stores the token of the selected profile in the keyring.
+func (app *application) setToken(token string) error {
+	if err := keyring.Set(config.AppName, app.profile.Key(), token); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (app *application) getToken(username string) (string, error) {
-	token, err := keyring.Get(config.AppName, username)
+// getToken reads the token of the selected profile from the keyring.
+func (app *application) getToken() (string, error) {
+	if app.profile.Key() == "" {
+		return "", withCode(exitAuth, fmt.Errorf("not logged in, please login first"))
+	}
+	token, err := keyring.Get(config.AppName, app.profile.Key())
 	if err != nil {
-		fmt.Println("Can't find token. Please login first")
-		return "", err
+		return "", withCode(exitAuth, fmt.Errorf("can't find token, please login first: %w", err))
 	}
 	return token, nil
 }
 
 func (app *application) version(context *cli.Context) error {
-	fmt.Printf("%s %s, commit %s, built at %s\n", config.AppName, version, commit, date)
-	return nil
+	if app.output == outputTable && !app.quiet {
+		fmt.Printf("%s %s, commit %s, built at %s\n", config.AppName, version, commit, date)
+		return nil
+	}
+
+	return app.print(result{
+		Value:  map[string]string{"version": version, "commit": commit, "date": date},
+		Header: []string{"VERSION", "COMMIT", "DATE"},
+		Rows:   [][]string{{version, commit, date}},
+		Quiet:  []string{version},
+	})
 }
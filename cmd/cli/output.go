@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bueti/shrinkster/shrink"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputCSV   = "csv"
+)
+
+var outputFormats = []string{outputTable, outputJSON, outputYAML, outputCSV}
+
+// Exit codes, so scripts can tell failures apart.
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitAuth     = 3
+	exitNotFound = 4
+	exitConflict = 5
+	exitServer   = 6
+)
+
+// codedError is an error with the exit code the CLI terminates with.
+type codedError struct {
+	code int
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// withCode attaches an exit code to an error.
+func withCode(code int, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+func usageError(format string, args ...any) error {
+	return withCode(exitUsage, fmt.Errorf(format, args...))
+}
+
+// exitCode returns the exit code for an error returned by a command.
+func exitCode(err error) int {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	return exitError
+}
+
+// apiError adds the action and a matching exit code to an error returned
+// by the client.
+func apiError(action string, err error) error {
+	err = fmt.Errorf("%s failed: %w", action, err)
+
+	status := shrink.StatusCode(err)
+	switch {
+	case status == 0:
+		return withCode(exitError, err)
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return withCode(exitAuth, err)
+	case status == http.StatusNotFound:
+		return withCode(exitNotFound, err)
+	case status == http.StatusConflict:
+		return withCode(exitConflict, err)
+	case status >= 500:
+		return withCode(exitServer, err)
+	default:
+		return withCode(exitError, err)
+	}
+}
+
+// result is what a command prints. Value is encoded as is for json and
+// yaml, Header and Rows make up the table and csv output, and Quiet is
+// printed one per line in quiet mode.
+type result struct {
+	Value  any
+	Header []string
+	Rows   [][]string
+	Quiet  []string
+}
+
+// checkOutput validates the global output flags, it runs before every command.
+func (app *application) checkOutput(context *cli.Context) error {
+	app.output = strings.ToLower(context.String("output"))
+	app.quiet = context.Bool("quiet")
+	for _, format := range outputFormats {
+		if app.output == format {
+			return nil
+		}
+	}
+	return usageError("unknown output format %q, use one of %s", app.output, strings.Join(outputFormats, ", "))
+}
+
+// print writes a result to stdout in the selected output format.
+func (app *application) print(r result) error {
+	return app.write(os.Stdout, r)
+}
+
+func (app *application) write(w io.Writer, r result) error {
+	if app.quiet {
+		for _, line := range r.Quiet {
+			fmt.Fprintln(w, line)
+		}
+		return nil
+	}
+
+	switch app.output {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r.Value)
+	case outputYAML:
+		// go through json, so the keys match the json output
+		data, err := json.Marshal(r.Value)
+		if err != nil {
+			return err
+		}
+		var v any
+		err = json.Unmarshal(data, &v)
+		if err != nil {
+			return err
+		}
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		return enc.Encode(v)
+	case outputCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(r.Header); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(r.Rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(r.Header, "\t"))
+		for _, row := range r.Rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+// info prints a status message for humans to stderr, so it doesn't end up
+// in pipelines. It is suppressed in quiet mode.
+func (app *application) info(format string, args ...any) {
+	if app.quiet {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
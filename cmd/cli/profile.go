@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bueti/shrinkster/internal/config"
+	"github.com/urfave/cli/v2"
+	"github.com/zalando/go-keyring"
+)
+
+// selectProfile picks the profile of the --profile flag, the environment or
+// the config file and points the client at its server. DEBUG=true selects the
+// local profile, unless a profile is given explicitly.
+func (app *application) selectProfile(context *cli.Context) error {
+	app.profileName = context.String("profile")
+	if app.profileName == "" && os.Getenv("DEBUG") == "true" {
+		app.profileName = config.LocalProfile
+	}
+	if app.profileName == "" {
+		app.profileName = app.cfg.Current
+	}
+	if app.profileName == "" {
+		app.profileName = config.DefaultProfile
+	}
+
+	// profile commands manage profiles, the selected one may not exist yet
+	if context.Args().First() == "profile" {
+		return nil
+	}
+
+	profile, err := app.cfg.Profile(app.profileName)
+	if err != nil {
+		return usageError("%s, see 'shrinkster profile list'", err)
+	}
+	app.profile = profile
+
+	return app.configureClient(profile)
+}
+
+// configureClient sets the host and TLS settings of the profile on the client.
+func (app *application) configureClient(profile *config.Profile) error {
+	app.client.Host = strings.TrimSuffix(profile.Host, "/")
+
+	if !profile.Insecure && profile.CACert == "" {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: profile.Insecure}
+	if profile.CACert != "" {
+		pem, err := os.ReadFile(profile.CACert)
+		if err != nil {
+			return fmt.Errorf("can't read CA certificate: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", profile.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	app.client.HttpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	return nil
+}
+
+// profileAdd adds a new profile or updates the server settings of an existing one.
+func (app *application) profileAdd(context *cli.Context) error {
+	if context.NArg() != 1 {
+		return usageError("expected exactly one argument: the profile name, flags go before it")
+	}
+	name := context.Args().First()
+
+	host := context.String("host")
+	u, err := url.Parse(host)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return usageError("invalid host %q, expected an URL like https://shrink.ch", host)
+	}
+
+	profile, ok := app.cfg.Profiles[name]
+	if !ok {
+		profile = &config.Profile{}
+		app.cfg.Profiles[name] = profile
+	}
+	profile.Host = strings.TrimSuffix(host, "/")
+	profile.Insecure = context.Bool("insecure")
+	profile.CACert = context.String("ca-cert")
+
+	if context.Bool("use") || app.cfg.Current == "" {
+		app.cfg.Current = name
+	}
+
+	err = config.Save(app.cfg)
+	if err != nil {
+		return err
+	}
+
+	app.info("Profile %s saved, run 'shrinkster --profile %s login' to log in", name, name)
+	return nil
+}
+
+// profileList lists all profiles.
+func (app *application) profileList(context *cli.Context) error {
+	type profileResponse struct {
+		Name     string `json:"name"`
+		Host     string `json:"host"`
+		Email    string `json:"email,omitempty"`
+		Insecure bool   `json:"insecure,omitempty"`
+		CACert   string `json:"ca_cert,omitempty"`
+		Current  bool   `json:"current"`
+	}
+
+	r := result{Header: []string{"CURRENT", "NAME", "HOST", "EMAIL"}}
+	var profiles []profileResponse
+	for _, name := range app.cfg.Names() {
+		p := app.cfg.Profiles[name]
+		current := name == app.profileName
+		profiles = append(profiles, profileResponse{
+			Name:     name,
+			Host:     p.Host,
+			Email:    p.Email,
+			Insecure: p.Insecure,
+			CACert:   p.CACert,
+			Current:  current,
+		})
+
+		marker := ""
+		if current {
+			marker = "*"
+		}
+		r.Rows = append(r.Rows, []string{marker, name, p.Host, p.Email})
+		r.Quiet = append(r.Quiet, name)
+	}
+	r.Value = profiles
+
+	return app.print(r)
+}
+
+// profileUse makes a profile the current one.
+func (app *application) profileUse(context *cli.Context) error {
+	if context.NArg() != 1 {
+		return usageError("expected exactly one argument: the profile name")
+	}
+	name := context.Args().First()
+
+	if _, ok := app.cfg.Profiles[name]; !ok {
+		return withCode(exitNotFound, fmt.Errorf("%w: %s", config.ErrNoProfile, name))
+	}
+	app.cfg.Current = name
+
+	err := config.Save(app.cfg)
+	if err != nil {
+		return err
+	}
+
+	app.info("Now using profile %s", name)
+	return nil
+}
+
+// profileRemove removes a profile and its token from the keyring.
+func (app *application) profileRemove(context *cli.Context) error {
+	if context.NArg() != 1 {
+		return usageError("expected exactly one argument: the profile name")
+	}
+	name := context.Args().First()
+
+	profile, ok := app.cfg.Profiles[name]
+	if !ok {
+		return withCode(exitNotFound, fmt.Errorf("%w: %s", config.ErrNoProfile, name))
+	}
+
+	if profile.Key() != "" {
+		err := keyring.Delete(config.AppName, profile.Key())
+		if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			app.logger.Warn("failed to remove token from keyring", "err", err)
+		}
+	}
+
+	delete(app.cfg.Profiles, name)
+	if app.cfg.Current == name {
+		app.cfg.Current = ""
+	}
+
+	err := config.Save(app.cfg)
+	if err != nil {
+		return err
+	}
+
+	app.info("Profile %s removed", name)
+	return nil
+}
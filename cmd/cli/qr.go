@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bueti/shrinkster/internal/qr"
+	"github.com/bueti/shrinkster/shrink"
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v2"
+)
+
+// qrCode writes the QR code of a url to a file or prints it to the terminal
+func (app *application) qrCode(context *cli.Context) error {
+	if context.NArg() != 1 {
+		return usageError("expected exactly one argument: the id, code or short url")
+	}
+
+	code, err := app.resolveShortCode(context.Context, context.Args().First())
+	if err != nil {
+		return err
+	}
+
+	out := context.String("file")
+	if out == "" {
+		return app.printQRCode(code, context.Bool("invert"))
+	}
+
+	format := context.String("format")
+	if format == "" {
+		format = formatFromFilename(out)
+	}
+	return app.saveQRCode(context.Context, code, out, format, context.Int("size"))
+}
+
+// resolveShortCode turns an id, code or short url into a short code. Ids
+// are looked up in the list of urls of the logged in user.
+func (app *application) resolveShortCode(ctx context.Context, arg string) (string, error) {
+	id, err := uuid.Parse(arg)
+	if err != nil {
+		return shortCodeFromInput(arg), nil
+	}
+
+	err = app.useToken()
+	if err != nil {
+		return "", err
+	}
+
+	link, err := app.findByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return link.ShortCode, nil
+}
+
+// saveQRCode fetches the rendered QR code from the server and writes it to a file.
+func (app *application) saveQRCode(ctx context.Context, code, filename, format string, size int) error {
+	data, err := app.client.QRCode(ctx, code, shrink.QROptions{Format: format, Size: size})
+	if err != nil {
+		return apiError("getting QR code", err)
+	}
+
+	err = os.WriteFile(filename, data, 0o644)
+	if err != nil {
+		return err
+	}
+
+	app.info("QR code written to %s", filename)
+	return nil
+}
+
+// printQRCode prints the QR code of a short code to the terminal.
+func (app *application) printQRCode(code string, invert bool) error {
+	out, err := renderQRCode(app.client.Host+"/s/"+code, invert)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.WriteString(out)
+	return err
+}
+
+// renderQRCode draws a QR code as unicode blocks, two modules per character.
+// By default light modules are drawn, which suits terminals with a dark
+// background. Use invert for light backgrounds.
+func renderQRCode(content string, invert bool) (string, error) {
+	modules, err := qr.Matrix(content, "M")
+	if err != nil {
+		return "", err
+	}
+
+	const quietZone = 2
+	size := len(modules) + 2*quietZone
+	dark := func(x, y int) bool {
+		x, y = x-quietZone, y-quietZone
+		if y < 0 || y >= len(modules) || x < 0 || x >= len(modules[y]) {
+			return false
+		}
+		return modules[y][x]
+	}
+
+	// lit reports whether the module at x, y is drawn
+	lit := func(x, y int) bool {
+		return dark(x, y) == invert
+	}
+
+	// QR codes have an odd number of modules, the half row below the last
+	// one is padded with the quiet zone
+	rows := size + size%2
+
+	var b strings.Builder
+	for y := 0; y < rows; y += 2 {
+		for x := 0; x < size; x++ {
+			top, bottom := lit(x, y), lit(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// shortCodeFromInput accepts a short code or a full short url.
+func shortCodeFromInput(input string) string {
+	input = strings.TrimSpace(input)
+	if i := strings.LastIndex(input, "/s/"); i >= 0 {
+		input = input[i+len("/s/"):]
+	}
+	return strings.TrimSuffix(input, "/")
+}
+
+func formatFromFilename(filename string) string {
+	if strings.EqualFold(filepath.Ext(filename), ".svg") {
+		return qr.FormatSVG
+	}
+	return qr.FormatPNG
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/bueti/shrinkster/shrink"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+// shortened is the outcome of shortening one url.
+type shortened struct {
+	Original  string `json:"original"`
+	ID        string `json:"id,omitempty"`
+	FullURL   string `json:"full_url,omitempty"`
+	QRCodeURL string `json:"qr_code_url,omitempty"`
+	// Existing is set if the url had been shortened before.
+	Existing bool   `json:"existing"`
+	Error    string `json:"error,omitempty"`
+}
+
+// shorten is the default action: it shortens the urls given as arguments,
+// one per line on stdin, or the one in the clipboard.
+func (app *application) shorten(context *cli.Context) error {
+	if context.Bool("clipboard") {
+		return app.shortenClipboard(context)
+	}
+
+	originals := context.Args().Slice()
+	if len(originals) == 0 && term.IsTerminal(int(os.Stdin.Fd())) {
+		return cli.ShowAppHelp(context)
+	}
+	if len(originals) == 0 || (len(originals) == 1 && originals[0] == "-") {
+		var err error
+		originals, err = readLines(os.Stdin)
+		if err != nil {
+			return err
+		}
+	}
+	for _, original := range originals {
+		if !isWebURL(original) {
+			return usageError("%q is neither a command nor an URL, see 'shrinkster help'", original)
+		}
+	}
+
+	err := app.useToken()
+	if err != nil {
+		return err
+	}
+
+	var (
+		r     = result{Header: []string{"ORIGINAL", "SHORT URL", "STATUS"}}
+		links = []shortened{}
+		errs  []error
+	)
+	for _, original := range originals {
+		link, err := app.createOrExisting(context.Context, shrink.CreateURLRequest{Original: original})
+		if err != nil {
+			errs = append(errs, err)
+			link.Error = err.Error()
+		}
+		links = append(links, link)
+
+		status := "created"
+		switch {
+		case link.Error != "":
+			status = "error: " + link.Error
+		case link.Existing:
+			status = "existing"
+		}
+		r.Rows = append(r.Rows, []string{link.Original, link.FullURL, status})
+		if link.FullURL != "" {
+			r.Quiet = append(r.Quiet, link.FullURL)
+		}
+	}
+	r.Value = links
+
+	err = app.print(r)
+	if err != nil {
+		return err
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return withCode(exitError, fmt.Errorf("%d of %d urls could not be shortened", len(errs), len(originals)))
+	}
+}
+
+// shortenClipboard shortens the url in the clipboard and replaces it with the short url.
+func (app *application) shortenClipboard(context *cli.Context) error {
+	original, err := clipboard.ReadAll()
+	if err != nil {
+		return fmt.Errorf("can't read the clipboard: %w", err)
+	}
+	original = strings.TrimSpace(original)
+	if !isWebURL(original) {
+		return usageError("the clipboard doesn't contain an URL")
+	}
+
+	err = app.useToken()
+	if err != nil {
+		return err
+	}
+
+	link, err := app.createOrExisting(context.Context, shrink.CreateURLRequest{Original: original})
+	if err != nil {
+		return err
+	}
+
+	err = clipboard.WriteAll(link.FullURL)
+	if err != nil {
+		return fmt.Errorf("can't write the clipboard: %w", err)
+	}
+	app.info("Copied %s to the clipboard", link.FullURL)
+
+	return app.print(result{
+		Value:  link,
+		Header: []string{"ORIGINAL", "SHORT URL"},
+		Rows:   [][]string{{link.Original, link.FullURL}},
+		Quiet:  []string{link.FullURL},
+	})
+}
+
+// createOrExisting creates a short url. If the user already shortened the
+// same url, the existing short url is returned instead of an error.
+func (app *application) createOrExisting(ctx context.Context, req shrink.CreateURLRequest) (shortened, error) {
+	link := shortened{Original: strings.TrimSpace(req.Original)}
+
+	created, err := app.client.CreateURL(ctx, req)
+	if err != nil {
+		var apiErr *shrink.APIError
+		if !errors.As(err, &apiErr) || apiErr.Existing == nil {
+			return link, apiError("creating url", err)
+		}
+		// a different short code was asked for
+		if req.ShortCode != "" && !strings.EqualFold(req.ShortCode, path.Base(apiErr.Existing.FullURL)) {
+			return link, apiError("creating url", err)
+		}
+		created = apiErr.Existing
+		link.Existing = true
+	}
+
+	link.ID = created.ID.String()
+	link.FullURL = created.FullURL
+	link.QRCodeURL = created.QRCodeURL
+	return link, nil
+}
+
+// useToken sets the token of the selected profile on the client.
+func (app *application) useToken() error {
+	token, err := app.getToken()
+	if err != nil {
+		return err
+	}
+	app.client.Token = token
+	return nil
+}
+
+// readLines returns the non-empty lines of r.
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, usageError("no urls given")
+	}
+	return lines, nil
+}
+
+// isWebURL reports whether s looks like an http or https url.
+func isWebURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
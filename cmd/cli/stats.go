@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bueti/shrinkster/shrink"
+	"github.com/urfave/cli/v2"
+)
+
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// stats shows the visits of a url over time and where they came from.
+func (app *application) stats(context *cli.Context) error {
+	if context.NArg() != 1 {
+		return usageError("expected exactly one argument: the id, code or short url")
+	}
+
+	var (
+		opts = shrink.StatsOptions{Interval: context.String("interval")}
+		err  error
+	)
+	if v := context.String("since"); v != "" {
+		opts.Since, err = parseTimeFlag(v, time.Now())
+		if err != nil {
+			return usageError("invalid --since: %s", err)
+		}
+	}
+	if v := context.String("until"); v != "" {
+		opts.Until, err = parseTimeFlag(v, time.Now())
+		if err != nil {
+			return usageError("invalid --until: %s", err)
+		}
+	}
+
+	code, err := app.resolveShortCode(context.Context, context.Args().First())
+	if err != nil {
+		return err
+	}
+
+	err = app.useToken()
+	if err != nil {
+		return err
+	}
+
+	stats, err := app.client.URLStats(context.Context, code, opts)
+	if err != nil {
+		return apiError("getting stats", err)
+	}
+
+	if app.output == outputTable && !app.quiet {
+		return writeStats(os.Stdout, code, stats)
+	}
+
+	r := result{
+		Value:  stats,
+		Header: []string{"START", "CLICKS"},
+		Quiet:  []string{strconv.Itoa(stats.Total)},
+	}
+	for _, bucket := range stats.Series {
+		r.Rows = append(r.Rows, []string{bucket.Start.Format(time.RFC3339), strconv.Itoa(bucket.Clicks)})
+	}
+	return app.print(r)
+}
+
+// writeStats draws the visits as a sparkline and the top referrers,
+// countries and devices as bar charts.
+func writeStats(w io.Writer, code string, stats *shrink.ClickStats) error {
+	layout := "2006-01-02"
+	if stats.Interval == "hour" {
+		layout = "2006-01-02 15:04"
+	}
+	fmt.Fprintf(w, "%s: %d visits from %s to %s, per %s\n\n", code, stats.Total,
+		stats.From.Local().Format(layout), stats.To.Local().Format(layout), stats.Interval)
+
+	counts := make([]int, len(stats.Series))
+	for i, bucket := range stats.Series {
+		counts[i] = bucket.Clicks
+	}
+	fmt.Fprintln(w, sparkline(counts))
+	if len(stats.Series) > 0 {
+		first, last := stats.Series[0].Start.Local().Format(layout), stats.Series[len(stats.Series)-1].Start.Local().Format(layout)
+		gap := len(stats.Series) - len(first) - len(last)
+		if gap < 1 {
+			gap = 1
+		}
+		fmt.Fprintf(w, "%s%s%s\n", first, strings.Repeat(" ", gap), last)
+		fmt.Fprintf(w, "peak: %d per %s\n", maxInt(counts), stats.Interval)
+	}
+
+	for _, top := range []struct {
+		title  string
+		counts []shrink.ClickCount
+	}{
+		{"Referrers", stats.Referrers},
+		{"Countries", stats.Countries},
+		{"Devices", stats.Devices},
+	} {
+		fmt.Fprintf(w, "\n%s\n", top.title)
+		if len(top.counts) == 0 {
+			fmt.Fprintln(w, "  -")
+			continue
+		}
+		writeBars(w, top.counts)
+	}
+	return nil
+}
+
+// sparkline draws one tick per value, scaled to the largest value.
+func sparkline(values []int) string {
+	peak := maxInt(values)
+	var b strings.Builder
+	for _, v := range values {
+		switch {
+		case v == 0:
+			b.WriteRune(' ')
+		case peak == 0:
+			b.WriteRune(sparkTicks[0])
+		default:
+			b.WriteRune(sparkTicks[(v*(len(sparkTicks)-1)+peak-1)/peak])
+		}
+	}
+	return b.String()
+}
+
+// writeBars draws a horizontal bar chart, scaled to the largest count.
+func writeBars(w io.Writer, counts []shrink.ClickCount) {
+	const width = 30
+
+	nameWidth, peak := 0, 0
+	for _, c := range counts {
+		if len(c.Name) > nameWidth {
+			nameWidth = len(c.Name)
+		}
+		if c.Clicks > peak {
+			peak = c.Clicks
+		}
+	}
+
+	for _, c := range counts {
+		bar := 0
+		if peak > 0 {
+			bar = (c.Clicks*width + peak - 1) / peak
+		}
+		fmt.Fprintf(w, "  %-*s  %s %d\n", nameWidth, c.Name, strings.Repeat("█", bar), c.Clicks)
+	}
+}
+
+// parseTimeFlag accepts dates, RFC 3339 timestamps and durations before
+// now like 12h, 7d or 4w.
+func parseTimeFlag(v string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return t, nil
+	}
+
+	if len(v) > 1 {
+		n, err := strconv.Atoi(v[:len(v)-1])
+		if err == nil && n >= 0 {
+			switch v[len(v)-1] {
+			case 'h':
+				return now.Add(-time.Duration(n) * time.Hour), nil
+			case 'd':
+				return now.AddDate(0, 0, -n), nil
+			case 'w':
+				return now.AddDate(0, 0, -7*n), nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("expected a date like 2006-01-02, a timestamp or a duration like 7d")
+}
+
+func maxInt(values []int) int {
+	peak := 0
+	for _, v := range values {
+		if v > peak {
+			peak = v
+		}
+	}
+	return peak
+}
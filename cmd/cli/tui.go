@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/atotto/clipboard"
+	"github.com/bueti/shrinkster/shrink"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	tuiErrorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	tuiLabelStyle = lipgloss.NewStyle().Bold(true).Width(12)
+	tuiHelpStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+	tuiFrameStyle = lipgloss.NewStyle().Padding(1, 2)
+)
+
+// tui starts the interactive link manager.
+func (app *application) tui(context *cli.Context) error {
+	token, err := app.getToken()
+	if err != nil {
+		return err
+	}
+	app.client.Token = token
+
+	if _, err := uuid.Parse(app.profile.ID); err != nil {
+		return withCode(exitAuth, fmt.Errorf("no account in profile %s, please login first", app.profileName))
+	}
+
+	_, err = tea.NewProgram(newTUIModel(context.Context, app), tea.WithAltScreen()).Run()
+	return err
+}
+
+type tuiMode int
+
+const (
+	tuiModeList tuiMode = iota
+	tuiModeForm
+	tuiModeConfirmDelete
+	tuiModeQR
+)
+
+// tuiKeys are the bindings of the list view in addition to the ones of the list itself.
+var tuiKeys = struct {
+	copy, create, edit, delete, qr, refresh key.Binding
+}{
+	copy:    key.NewBinding(key.WithKeys("enter", "y"), key.WithHelp("enter", "copy")),
+	create:  key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "new")),
+	edit:    key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "edit")),
+	delete:  key.NewBinding(key.WithKeys("d", "x"), key.WithHelp("d", "delete")),
+	qr:      key.NewBinding(key.WithKeys("v"), key.WithHelp("v", "qr code")),
+	refresh: key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "refresh")),
+}
+
+// linkItem is a link in the list.
+type linkItem struct {
+	url      shrink.URL
+	shortURL string
+}
+
+func (i linkItem) Title() string {
+	return fmt.Sprintf("%s  (%d visits)", i.url.ShortCode, i.url.Visits)
+}
+
+func (i linkItem) Description() string {
+	desc := i.url.Original
+	if i.url.Disabled {
+		desc += " · disabled"
+	}
+	if i.url.ExpiresAt != nil {
+		desc += " · expires " + i.url.ExpiresAt.Format(expiryDateLayout)
+	}
+	return desc
+}
+
+func (i linkItem) FilterValue() string {
+	return i.url.ShortCode + " " + i.url.Original
+}
+
+// expiryDateLayout is the format of expiry dates, the same as on the website.
+const expiryDateLayout = "2006-01-02"
+
+// linkForm creates a new link, or edits the link with id.
+type linkForm struct {
+	edit   bool
+	id     uuid.UUID
+	labels []string
+	inputs []textinput.Model
+	focus  int
+	err    error
+}
+
+const (
+	fieldOriginal  = "Original"
+	fieldShortCode = "Short code"
+	fieldExpires   = "Expires"
+)
+
+func newLinkForm(item *linkItem) linkForm {
+	f := linkForm{labels: []string{fieldOriginal, fieldShortCode, fieldExpires}}
+	if item != nil {
+		// the short code is part of printed QR codes, so it can't be changed
+		f.edit = true
+		f.id = item.url.ID
+		f.labels = []string{fieldOriginal, fieldExpires}
+	}
+
+	for _, label := range f.labels {
+		input := textinput.New()
+		input.Prompt = ""
+		input.CharLimit = 2048
+		input.Width = 60
+		switch label {
+		case fieldOriginal:
+			input.Placeholder = "https://example.com"
+			if item != nil {
+				input.SetValue(item.url.Original)
+			}
+		case fieldShortCode:
+			input.Placeholder = "random"
+		case fieldExpires:
+			input.Placeholder = "never, or " + expiryDateLayout
+			if item != nil && item.url.ExpiresAt != nil {
+				input.SetValue(item.url.ExpiresAt.Format(expiryDateLayout))
+			}
+		}
+		f.inputs = append(f.inputs, input)
+	}
+	f.inputs[0].Focus()
+	return f
+}
+
+func (f *linkForm) value(label string) string {
+	for i, l := range f.labels {
+		if l == label {
+			return strings.TrimSpace(f.inputs[i].Value())
+		}
+	}
+	return ""
+}
+
+func (f *linkForm) setFocus(i int) {
+	f.inputs[f.focus].Blur()
+	f.focus = (i + len(f.inputs)) % len(f.inputs)
+	f.inputs[f.focus].Focus()
+}
+
+func (f linkForm) View() string {
+	var b strings.Builder
+	if !f.edit {
+		b.WriteString("New link\n\n")
+	} else {
+		b.WriteString("Edit link\n\n")
+	}
+	for i, label := range f.labels {
+		b.WriteString(tuiLabelStyle.Render(label) + f.inputs[i].View() + "\n")
+	}
+	if f.err != nil {
+		b.WriteString("\n" + tuiErrorStyle.Render(f.err.Error()) + "\n")
+	}
+	b.WriteString("\n" + tuiHelpStyle.Render("tab next field • enter save • esc cancel"))
+	return b.String()
+}
+
+type (
+	linksLoadedMsg []shrink.URL
+	linkSavedMsg   string
+	tuiErrMsg      struct{ err error }
+)
+
+type tuiModel struct {
+	ctx context.Context
+	app *application
+
+	mode tuiMode
+	list list.Model
+	form linkForm
+	qr   string
+}
+
+func newTUIModel(ctx context.Context, app *application) tuiModel {
+	l := list.New(nil, list.NewDefaultDelegate(), 0, 0)
+	l.Title = "Shrinkster · " + app.profileName
+	l.SetStatusBarItemName("link", "links")
+	l.StatusMessageLifetime = 5 * time.Second
+	l.AdditionalShortHelpKeys = func() []key.Binding {
+		return []key.Binding{tuiKeys.copy, tuiKeys.create, tuiKeys.delete}
+	}
+	l.AdditionalFullHelpKeys = func() []key.Binding {
+		return []key.Binding{tuiKeys.copy, tuiKeys.create, tuiKeys.edit, tuiKeys.delete, tuiKeys.qr, tuiKeys.refresh}
+	}
+
+	return tuiModel{ctx: ctx, app: app, list: l}
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return tea.Batch(m.list.StartSpinner(), m.loadLinks)
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		h, v := tuiFrameStyle.GetFrameSize()
+		m.list.SetSize(msg.Width-h, msg.Height-v)
+		return m, nil
+
+	case linksLoadedMsg:
+		m.list.StopSpinner()
+		items := make([]list.Item, 0, len(msg))
+		for _, u := range msg {
+			items = append(items, linkItem{url: u, shortURL: m.app.client.Host + "/s/" + u.ShortCode})
+		}
+		return m, m.list.SetItems(items)
+
+	case linkSavedMsg:
+		m.mode = tuiModeList
+		return m, tea.Batch(m.list.NewStatusMessage(string(msg)), m.loadLinks)
+
+	case tuiErrMsg:
+		m.list.StopSpinner()
+		if m.mode == tuiModeForm {
+			m.form.err = msg.err
+			return m, nil
+		}
+		return m, m.list.NewStatusMessage(tuiErrorStyle.Render(msg.err.Error()))
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		switch m.mode {
+		case tuiModeForm:
+			return m.updateForm(msg)
+		case tuiModeConfirmDelete:
+			m.mode = tuiModeList
+			if msg.String() != "y" {
+				return m, nil
+			}
+			if item, ok := m.list.SelectedItem().(linkItem); ok {
+				return m, m.deleteLink(item)
+			}
+			return m, nil
+		case tuiModeQR:
+			m.mode = tuiModeList
+			return m, nil
+		}
+
+		// while typing a filter, keys belong to the filter
+		if m.list.SettingFilter() {
+			break
+		}
+		item, selected := m.list.SelectedItem().(linkItem)
+		switch {
+		case key.Matches(msg, tuiKeys.create):
+			m.form = newLinkForm(nil)
+			m.mode = tuiModeForm
+			return m, textinput.Blink
+		case key.Matches(msg, tuiKeys.refresh):
+			return m, tea.Batch(m.list.StartSpinner(), m.loadLinks)
+		case !selected:
+		case key.Matches(msg, tuiKeys.copy):
+			if err := clipboard.WriteAll(item.shortURL); err != nil {
+				return m, m.list.NewStatusMessage(tuiErrorStyle.Render("Can't copy to the clipboard: " + err.Error()))
+			}
+			return m, m.list.NewStatusMessage("Copied " + item.shortURL)
+		case key.Matches(msg, tuiKeys.edit):
+			m.form = newLinkForm(&item)
+			m.mode = tuiModeForm
+			return m, textinput.Blink
+		case key.Matches(msg, tuiKeys.delete):
+			m.mode = tuiModeConfirmDelete
+			return m, nil
+		case key.Matches(msg, tuiKeys.qr):
+			out, err := renderQRCode(item.shortURL, false)
+			if err != nil {
+				return m, m.list.NewStatusMessage(tuiErrorStyle.Render(err.Error()))
+			}
+			m.qr = out
+			m.mode = tuiModeQR
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m tuiModel) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.mode = tuiModeList
+		return m, nil
+	case "enter":
+		return m, m.saveLink(m.form)
+	case "tab", "down":
+		m.form.setFocus(m.form.focus + 1)
+		return m, nil
+	case "shift+tab", "up":
+		m.form.setFocus(m.form.focus - 1)
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.form.inputs[m.form.focus], cmd = m.form.inputs[m.form.focus].Update(msg)
+	return m, cmd
+}
+
+func (m tuiModel) View() string {
+	switch m.mode {
+	case tuiModeForm:
+		return tuiFrameStyle.Render(m.form.View())
+	case tuiModeQR:
+		item, _ := m.list.SelectedItem().(linkItem)
+		return tuiFrameStyle.Render(m.qr + "\n" + item.shortURL + "\n\n" + tuiHelpStyle.Render("press any key to go back"))
+	case tuiModeConfirmDelete:
+		item, _ := m.list.SelectedItem().(linkItem)
+		return tuiFrameStyle.Render(fmt.Sprintf("Delete %s → %s?\n\n", item.url.ShortCode, item.url.Original) +
+			tuiHelpStyle.Render("y delete • any other key cancel"))
+	}
+	return tuiFrameStyle.Render(m.list.View())
+}
+
+func (m tuiModel) loadLinks() tea.Msg {
+	var urls []shrink.URL
+	it := m.app.client.MyURLs(m.ctx, 100)
+	for it.Next() {
+		urls = append(urls, it.URL())
+	}
+	if err := it.Err(); err != nil {
+		return tuiErrMsg{fmt.Errorf("loading links failed: %w", err)}
+	}
+	return linksLoadedMsg(urls)
+}
+
+// saveLink creates or updates the link of the form.
+func (m tuiModel) saveLink(f linkForm) tea.Cmd {
+	original := f.value(fieldOriginal)
+	shortCode := f.value(fieldShortCode)
+
+	var expiresAt *time.Time
+	if v := f.value(fieldExpires); v != "" {
+		t, err := time.Parse(expiryDateLayout, v)
+		if err != nil {
+			return func() tea.Msg {
+				return tuiErrMsg{errors.New("invalid expiry date, use " + expiryDateLayout)}
+			}
+		}
+		expiresAt = &t
+	}
+
+	return func() tea.Msg {
+		if f.edit {
+			_, err := m.app.client.UpdateURL(m.ctx, f.id, shrink.UpdateURLRequest{Original: original, ExpiresAt: expiresAt})
+			if err != nil {
+				return tuiErrMsg{err}
+			}
+			return linkSavedMsg("Link saved")
+		}
+
+		created, err := m.app.client.CreateURL(m.ctx, shrink.CreateURLRequest{
+			Original:  original,
+			ShortCode: shortCode,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			return tuiErrMsg{err}
+		}
+		return linkSavedMsg("Created " + created.FullURL)
+	}
+}
+
+func (m tuiModel) deleteLink(item linkItem) tea.Cmd {
+	return func() tea.Msg {
+		err := m.app.client.DeleteURL(m.ctx, item.url.ID)
+		if err != nil {
+			return tuiErrMsg{fmt.Errorf("deleting %s failed: %w", item.url.ShortCode, err)}
+		}
+		return linkSavedMsg("Deleted " + item.url.ShortCode)
+	}
+}
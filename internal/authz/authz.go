@@ -0,0 +1,57 @@
+// Package authz decides which users may act on which resources. Policies
+// are plain functions of the user, the action and the resource, so they
+// don't depend on a request.
+package authz
+
+import (
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/google/uuid"
+)
+
+// Action is what a user wants to do with a resource.
+type Action string
+
+const (
+	Read   Action = "read"
+	Update Action = "update"
+	Delete Action = "delete"
+)
+
+// RoleAdmin is the role of users which may act on any resource.
+const RoleAdmin = "admin"
+
+// Policy reports whether user may perform action on resource.
+type Policy func(user *model.User, action Action, resource any) bool
+
+// Owned is implemented by resources which belong to a user.
+type Owned interface {
+	OwnerID() uuid.UUID
+}
+
+// OwnerOrAdmin allows admins anything and users anything on the resources
+// they own. It ignores the action: owners may read, update and delete alike.
+func OwnerOrAdmin(user *model.User, action Action, resource any) bool {
+	if user.Role == RoleAdmin {
+		return true
+	}
+	owned, ok := resource.(Owned)
+	return ok && owned.OwnerID() == user.ID
+}
+
+// The policies of the resources.
+var (
+	Urls  Policy = OwnerOrAdmin
+	Users Policy = OwnerOrAdmin
+)
+
+// Check returns an error of kind model.ErrForbidden if policy doesn't allow
+// user to perform action on resource, and model.ErrNoUser without a user.
+func Check(policy Policy, user *model.User, action Action, resource any) error {
+	if user == nil {
+		return model.ErrNoUser
+	}
+	if !policy(user, action, resource) {
+		return model.Errorf(model.ErrForbidden, "Access Denied")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package authz
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bueti/shrinkster/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestOwnerOrAdmin(t *testing.T) {
+	owner := &model.User{ID: uuid.New(), Role: "user"}
+	other := &model.User{ID: uuid.New(), Role: "user"}
+	admin := &model.User{ID: uuid.New(), Role: RoleAdmin}
+	url := &model.Url{UserID: owner.ID}
+
+	tests := []struct {
+		name     string
+		user     *model.User
+		resource any
+		want     bool
+	}{
+		{"admin", admin, url, true},
+		{"owner", owner, url, true},
+		{"non-owner", other, url, false},
+		{"own account", owner, owner, true},
+		{"other account", other, owner, false},
+		{"admin on unowned resource", admin, struct{}{}, true},
+		{"user on unowned resource", owner, struct{}{}, false},
+	}
+	for _, tt := range tests {
+		for _, action := range []Action{Read, Update, Delete} {
+			if got := OwnerOrAdmin(tt.user, action, tt.resource); got != tt.want {
+				t.Errorf("%s: OwnerOrAdmin(%s) = %v, want %v", tt.name, action, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	owner := &model.User{ID: uuid.New(), Role: "user"}
+	other := &model.User{ID: uuid.New(), Role: "user"}
+	admin := &model.User{ID: uuid.New(), Role: RoleAdmin}
+	url := &model.Url{UserID: owner.ID}
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		user    *model.User
+		wantErr error
+	}{
+		{"admin", Urls, admin, nil},
+		{"owner", Urls, owner, nil},
+		{"non-owner", Urls, other, model.ErrForbidden},
+		{"nil user", Urls, nil, model.ErrNoUser},
+		{"users policy", Users, other, model.ErrForbidden},
+	}
+	for _, tt := range tests {
+		for _, action := range []Action{Read, Update, Delete} {
+			err := Check(tt.policy, tt.user, action, url)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("%s: Check(%s) = %v, want nil", tt.name, action, err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: Check(%s) = %v, want %v", tt.name, action, err, tt.wantErr)
+			}
+		}
+	}
+}
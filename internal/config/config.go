@@ -5,76 +5,166 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/adrg/xdg"
-	"github.com/bueti/shrinkster/internal/model"
-	"github.com/google/uuid"
 	"gopkg.in/yaml.v3"
 )
 
 const (
 	AppName = "shrinkster"
 	CfgFile = "config.yaml"
+	// DefaultProfile is used if no profile is selected.
+	DefaultProfile = "default"
+	DefaultHost    = "https://shrink.ch"
+	// LocalProfile is a server on the local machine, for development.
+	LocalProfile = "local"
+	LocalHost    = "https://localhost:8080"
 )
 
+// builtinHosts are the hosts of the profiles which exist without being added.
+var builtinHosts = map[string]string{
+	DefaultProfile: DefaultHost,
+	LocalProfile:   LocalHost,
+}
+
+var ErrNoProfile = errors.New("profile does not exist")
+
+// Profile is a server and the account used on it.
+type Profile struct {
+	Host     string `yaml:"host"`
+	Email    string `yaml:"email,omitempty"`
+	ID       string `yaml:"id,omitempty"`
+	Insecure bool   `yaml:"insecure,omitempty"`
+	// CACert is a PEM file with additional CAs to trust, e.g. for a staging instance.
+	CACert string `yaml:"ca_cert,omitempty"`
+	// KeyringKey is the keyring entry holding the token, it defaults to the email.
+	KeyringKey string `yaml:"keyring_key,omitempty"`
+}
+
+// Key returns the name of the keyring entry of the profile.
+func (p *Profile) Key() string {
+	if p.KeyringKey != "" {
+		return p.KeyringKey
+	}
+	return p.Email
+}
+
 type Config struct {
-	ID    uuid.UUID `yaml:"id"`
-	Email string    `yaml:"email"`
+	Current  string              `yaml:"current,omitempty"`
+	Profiles map[string]*Profile `yaml:"profiles,omitempty"`
+
+	// ID and Email are the single account of old config files, Load moves
+	// them into the default profile.
+	ID    string `yaml:"id,omitempty"`
+	Email string `yaml:"email,omitempty"`
 }
 
-// Load reads the config file and returns the config.
+// Load reads the config file and returns the config. A missing file results
+// in an empty config.
 func Load() (Config, error) {
-	dir, err := xdg.ConfigFile(AppName)
+	config := Config{Profiles: map[string]*Profile{}}
+
+	fullPath, err := path()
 	if err != nil {
-		return Config{}, err
+		return config, err
 	}
-	fullPath := filepath.Join(dir, CfgFile)
 
 	data, err := os.ReadFile(fullPath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return Config{}, fmt.Errorf("can't open config file: %s", fullPath)
+			return config, nil
 		}
-		return Config{}, err
+		return config, err
 	}
 
-	config := Config{}
 	err = yaml.Unmarshal(data, &config)
 	if err != nil {
-		return Config{}, err
+		return config, fmt.Errorf("can't parse config file %s: %w", fullPath, err)
+	}
+	if config.Profiles == nil {
+		config.Profiles = map[string]*Profile{}
 	}
+	config.migrate()
 
 	return config, nil
 }
 
+// migrate moves the account of an old config file into the default profile.
+func (c *Config) migrate() {
+	if c.Email == "" {
+		return
+	}
+	if _, ok := c.Profiles[DefaultProfile]; !ok {
+		c.Profiles[DefaultProfile] = &Profile{
+			Host:  DefaultHost,
+			Email: c.Email,
+			ID:    c.ID,
+		}
+		if c.Current == "" {
+			c.Current = DefaultProfile
+		}
+	}
+	c.ID = ""
+	c.Email = ""
+}
+
+// Profile returns the profile with the given name. If name is empty, the
+// current profile is returned. The default and the local profile always exist.
+func (c *Config) Profile(name string) (*Profile, error) {
+	if name == "" {
+		name = c.Current
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+
+	p, ok := c.Profiles[name]
+	if ok {
+		return p, nil
+	}
+	if host, ok := builtinHosts[name]; ok {
+		p = &Profile{Host: host}
+		c.Profiles[name] = p
+		return p, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoProfile, name)
+}
+
+// Names returns the names of all profiles in alphabetical order.
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Save writes the config to the config file.
-func Save(user model.UserLoginResponse) error {
-	fullPath, err := xdg.ConfigFile(AppName)
+func Save(config Config) error {
+	fullPath, err := path()
 	if err != nil {
 		return err
 	}
-	err = os.MkdirAll(fullPath, os.ModePerm)
+	err = os.MkdirAll(filepath.Dir(fullPath), os.ModePerm)
 	if err != nil {
 		return err
 	}
 
-	f, err := os.OpenFile(filepath.Join(fullPath, CfgFile), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	f, err := os.OpenFile(fullPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
 	}
 
-	config := Config{
-		ID:    user.ID,
-		Email: user.Email,
-	}
-
 	data, err := yaml.Marshal(&config)
 	if err != nil {
+		f.Close()
 		return err
 	}
 
 	if _, err := f.Write(data); err != nil {
-		f.Close() // ignore error; SetUsername error takes precedence
+		f.Close() // ignore error; Write error takes precedence
 		return err
 	}
 	if err := f.Close(); err != nil {
@@ -83,3 +173,11 @@ func Save(user model.UserLoginResponse) error {
 
 	return nil
 }
+
+func path() (string, error) {
+	dir, err := xdg.ConfigFile(AppName)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, CfgFile), nil
+}
@@ -0,0 +1,26 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Log writes the plain text version of emails to w instead of sending them.
+// It is meant for local development.
+type Log struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLog(w io.Writer) *Log {
+	return &Log{w: w}
+}
+
+func (l *Log) Send(msg *Message) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := fmt.Fprintf(l.w, "To: %s\nFrom: %s\nSubject: %s\n\n%s\n\n", msg.To, msg.From, msg.Subject, msg.PlainBody)
+	return err
+}
@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Maildir stores emails as files in a maildir, so they can be read with any
+// mail client or inspected by tests.
+type Maildir struct {
+	dir     string
+	counter atomic.Uint64
+}
+
+// NewMaildir creates the maildir at dir if it doesn't exist yet.
+func NewMaildir(dir string) (*Maildir, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0o750)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Maildir{dir: dir}, nil
+}
+
+// Send writes the message into tmp first and moves it into new afterwards,
+// so readers never see partially written messages.
+func (m *Maildir) Send(msg *Message) error {
+	name := fmt.Sprintf("%d.%d_%d.shrinkster", time.Now().UnixNano(), os.Getpid(), m.counter.Add(1))
+	tmpPath := filepath.Join(m.dir, "tmp", name)
+
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	_, err = msg.mime().WriteTo(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, filepath.Join(m.dir, "new", name))
+}
@@ -4,26 +4,34 @@ import (
 	"bytes"
 	"embed"
 	"html/template"
-	"time"
-
-	"github.com/go-mail/mail/v2"
 )
 
 //go:embed "templates"
 var templateFS embed.FS
 
-type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+// Message is a rendered email.
+type Message struct {
+	To        string
+	From      string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+// Transport delivers rendered emails.
+type Transport interface {
+	Send(msg *Message) error
 }
 
-func New(host string, port int, username, password, sender string) Mailer {
-	dialer := mail.NewDialer(host, port, username, password)
-	dialer.Timeout = 5 * time.Second
+type Mailer struct {
+	transport Transport
+	sender    string
+}
 
+func New(transport Transport, sender string) Mailer {
 	return Mailer{
-		dialer: dialer,
-		sender: sender,
+		transport: transport,
+		sender:    sender,
 	}
 }
 
@@ -51,17 +59,11 @@ func (m Mailer) Send(recipient, templateFile string, data any) error {
 		return err
 	}
 
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
-
-	err = m.dialer.DialAndSend(msg)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return m.transport.Send(&Message{
+		To:        recipient,
+		From:      m.sender,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	})
 }
@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMemoryActivationToken(t *testing.T) {
+	memory := NewMemory()
+	m := New(memory, "Shrinkster <no-reply@shrink.ch>")
+
+	err := m.Send("old@example.com", "welcome.tmpl.html", map[string]any{"activationToken": "OLDTOKEN", "userID": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Send("new@example.com", "welcome.tmpl.html", map[string]any{"activationToken": "NEWTOKEN", "userID": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, ok := memory.Last("new@example.com")
+	if !ok {
+		t.Fatal("no email sent to new@example.com")
+	}
+	if msg.From != "Shrinkster <no-reply@shrink.ch>" || msg.Subject == "" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if token := activationToken(t, msg.PlainBody); token != "NEWTOKEN" {
+		t.Errorf("activation token = %q, want NEWTOKEN", token)
+	}
+
+	if n := len(memory.Messages()); n != 2 {
+		t.Errorf("got %d messages, want 2", n)
+	}
+	memory.Reset()
+	if _, ok := memory.Last("new@example.com"); ok {
+		t.Error("Last found an email after Reset")
+	}
+}
+
+// activationToken returns the token of the activation link in body.
+func activationToken(t *testing.T, body string) string {
+	t.Helper()
+	for _, field := range strings.Fields(body) {
+		link, err := url.Parse(field)
+		if err == nil && link.Path == "/users/activate" {
+			return link.Query().Get("token")
+		}
+	}
+	t.Fatalf("no activation link in %q", body)
+	return ""
+}
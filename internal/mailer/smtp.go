@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"time"
+
+	"github.com/go-mail/mail/v2"
+)
+
+// SMTP delivers emails through an SMTP server.
+type SMTP struct {
+	dialer *mail.Dialer
+}
+
+func NewSMTP(host string, port int, username, password string) *SMTP {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTP{dialer: dialer}
+}
+
+func (s *SMTP) Send(msg *Message) error {
+	return s.dialer.DialAndSend(msg.mime())
+}
+
+// mime converts the message into a multipart MIME message.
+func (msg *Message) mime() *mail.Message {
+	m := mail.NewMessage()
+	m.SetHeader("To", msg.To)
+	m.SetHeader("From", msg.From)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.PlainBody)
+	m.AddAlternative("text/html", msg.HTMLBody)
+	return m
+}
@@ -0,0 +1,249 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Click is a single visit of a short link. Url.Visits holds the total,
+// clicks allow counting the visits in a period.
+type Click struct {
+	ID        uint      `gorm:"primaryKey"`
+	UrlID     uuid.UUID `gorm:"type:uuid;not null;index:idx_clicks_url_created"`
+	Url       Url       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedAt time.Time `gorm:"not null;index:idx_clicks_url_created"`
+	// Referrer is the host of the referring page, empty for direct visits.
+	Referrer string `gorm:"type:varchar(255)"`
+	// Country is the ISO 3166 code reported by the CDN, if any.
+	Country string `gorm:"type:varchar(2)"`
+	// Device is desktop, mobile, tablet, bot or unknown.
+	Device string `gorm:"type:varchar(16)"`
+}
+
+// Device classes of clicks.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// StatsIntervals are the intervals clicks can be grouped by.
+var StatsIntervals = []string{"hour", "day", "week", "month"}
+
+// maxBuckets is the longest series of clicks which can be requested.
+const maxBuckets = 1000
+
+type ClickModel struct {
+	DB *gorm.DB
+}
+
+// CountByUrl returns the number of clicks per url of a user in [from, to).
+func (m ClickModel) CountByUrl(userID uuid.UUID, from, to time.Time) (map[uuid.UUID]int, error) {
+	var rows []struct {
+		UrlID  uuid.UUID
+		Clicks int
+	}
+	result := m.DB.Model(&Click{}).
+		Select("clicks.url_id, count(*) AS clicks").
+		Joins("JOIN urls ON urls.id = clicks.url_id").
+		Where("urls.user_id = ? AND clicks.created_at >= ? AND clicks.created_at < ?", userID, from, to).
+		Group("clicks.url_id").
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	counts := make(map[uuid.UUID]int, len(rows))
+	for _, row := range rows {
+		counts[row.UrlID] = row.Clicks
+	}
+	return counts, nil
+}
+
+// ClickSummary is the number of recent clicks of a url.
+type ClickSummary struct {
+	Last24h     int        `json:"last_24h"`
+	Last7d      int        `json:"last_7d"`
+	Last30d     int        `json:"last_30d"`
+	LastClickAt *time.Time `json:"last_click_at,omitempty"`
+}
+
+// Summary counts the clicks of a url in the last day, week and 30 days.
+func (m ClickModel) Summary(urlID uuid.UUID, now time.Time) (ClickSummary, error) {
+	var row struct {
+		Last24h     int
+		Last7d      int
+		Last30d     int
+		LastClickAt *time.Time
+	}
+	result := m.DB.Model(&Click{}).
+		Select("count(*) FILTER (WHERE created_at >= ?) AS last24h, "+
+			"count(*) FILTER (WHERE created_at >= ?) AS last7d, "+
+			"count(*) AS last30d, max(created_at) AS last_click_at",
+			now.AddDate(0, 0, -1), now.AddDate(0, 0, -7)).
+		Where("url_id = ? AND created_at >= ?", urlID, now.AddDate(0, 0, -30)).
+		Scan(&row)
+	if result.Error != nil {
+		return ClickSummary{}, result.Error
+	}
+
+	summary := ClickSummary{Last24h: row.Last24h, Last7d: row.Last7d, Last30d: row.Last30d, LastClickAt: row.LastClickAt}
+	if summary.LastClickAt == nil {
+		// older clicks fall out of the window above
+		var last Click
+		result = m.DB.Where("url_id = ?", urlID).Order("created_at DESC").Limit(1).Find(&last)
+		if result.Error != nil {
+			return ClickSummary{}, result.Error
+		}
+		if result.RowsAffected > 0 {
+			summary.LastClickAt = &last.CreatedAt
+		}
+	}
+	return summary, nil
+}
+
+// ClickBucket is the number of clicks in the interval starting at Start.
+type ClickBucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int       `json:"clicks"`
+}
+
+// ClickCount is the number of clicks with a referrer, country or device.
+type ClickCount struct {
+	Name   string `json:"name"`
+	Clicks int    `json:"clicks"`
+}
+
+// ClickStats are the clicks of a url in [From, To).
+type ClickStats struct {
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	Interval  string        `json:"interval"`
+	Total     int           `json:"total"`
+	Series    []ClickBucket `json:"series"`
+	Referrers []ClickCount  `json:"referrers"`
+	Countries []ClickCount  `json:"countries"`
+	Devices   []ClickCount  `json:"devices"`
+}
+
+// Stats returns the clicks of a url in [from, to) per interval, and the top
+// referrers, countries and devices.
+func (m ClickModel) Stats(urlID uuid.UUID, from, to time.Time, interval string) (ClickStats, error) {
+	from, to = from.UTC(), to.UTC()
+	if !to.After(from) {
+		return ClickStats{}, Errorf(ErrValidation, "since must be before until")
+	}
+
+	starts, err := bucketStarts(from, to, interval)
+	if err != nil {
+		return ClickStats{}, err
+	}
+
+	// interval is one of StatsIntervals, bucketStarts checked it
+	var rows []struct {
+		Bucket time.Time
+		Clicks int
+	}
+	result := m.DB.Model(&Click{}).
+		Select("date_trunc('"+interval+"', created_at AT TIME ZONE 'UTC') AS bucket, count(*) AS clicks").
+		Where("url_id = ? AND created_at >= ? AND created_at < ?", urlID, from, to).
+		Group("bucket").
+		Scan(&rows)
+	if result.Error != nil {
+		return ClickStats{}, result.Error
+	}
+
+	counts := make(map[time.Time]int, len(rows))
+	for _, row := range rows {
+		counts[time.Date(row.Bucket.Year(), row.Bucket.Month(), row.Bucket.Day(), row.Bucket.Hour(), 0, 0, 0, time.UTC)] += row.Clicks
+	}
+
+	stats := ClickStats{From: from, To: to, Interval: interval, Series: make([]ClickBucket, 0, len(starts))}
+	for _, start := range starts {
+		stats.Series = append(stats.Series, ClickBucket{Start: start, Clicks: counts[start]})
+		stats.Total += counts[start]
+	}
+
+	for _, top := range []struct {
+		column string
+		dest   *[]ClickCount
+	}{
+		{"referrer", &stats.Referrers},
+		{"country", &stats.Countries},
+		{"device", &stats.Devices},
+	} {
+		*top.dest, err = m.top(urlID, from, to, top.column)
+		if err != nil {
+			return ClickStats{}, err
+		}
+	}
+
+	return stats, nil
+}
+
+// top returns the ten most frequent values of column. Empty values are
+// counted as "direct" for referrers and "unknown" otherwise.
+func (m ClickModel) top(urlID uuid.UUID, from, to time.Time, column string) ([]ClickCount, error) {
+	var rows []ClickCount
+	result := m.DB.Model(&Click{}).
+		Select(column+" AS name, count(*) AS clicks").
+		Where("url_id = ? AND created_at >= ? AND created_at < ?", urlID, from, to).
+		Group(column).
+		Order("clicks DESC, name").
+		Limit(10).
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	for i := range rows {
+		if rows[i].Name != "" {
+			continue
+		}
+		rows[i].Name = DeviceUnknown
+		if column == "referrer" {
+			rows[i].Name = "direct"
+		}
+	}
+	return rows, nil
+}
+
+// bucketStarts returns the start of every interval overlapping [from, to),
+// truncated the same way as date_trunc.
+func bucketStarts(from, to time.Time, interval string) ([]time.Time, error) {
+	var (
+		start time.Time
+		next  func(time.Time) time.Time
+	)
+	switch interval {
+	case "hour":
+		start = from.Truncate(time.Hour)
+		next = func(t time.Time) time.Time { return t.Add(time.Hour) }
+	case "day":
+		start = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case "week":
+		// weeks start on monday, like in postgres
+		start = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+		start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case "month":
+		start = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	default:
+		return nil, Errorf(ErrValidation, "interval must be one of %v", StatsIntervals)
+	}
+
+	var starts []time.Time
+	for t := start; t.Before(to); t = next(t) {
+		if len(starts) == maxBuckets {
+			return nil, Errorf(ErrValidation, "too many intervals, use a longer interval or a shorter period")
+		}
+		starts = append(starts, t)
+	}
+	return starts, nil
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestBucketStarts(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		interval string
+		want     []string
+	}{
+		{"hours", "2024-03-10T10:30:00Z", "2024-03-10T13:00:00Z", "hour",
+			[]string{"2024-03-10T10:00:00Z", "2024-03-10T11:00:00Z", "2024-03-10T12:00:00Z"}},
+		{"days", "2024-02-28T18:00:00Z", "2024-03-01T06:00:00Z", "day",
+			[]string{"2024-02-28T00:00:00Z", "2024-02-29T00:00:00Z", "2024-03-01T00:00:00Z"}},
+		// 2024-03-10 is a sunday, its week started on monday the 4th
+		{"weeks", "2024-03-10T12:00:00Z", "2024-03-19T00:00:00Z", "week",
+			[]string{"2024-03-04T00:00:00Z", "2024-03-11T00:00:00Z", "2024-03-18T00:00:00Z"}},
+		{"week from a monday", "2024-03-11T00:00:00Z", "2024-03-12T00:00:00Z", "week",
+			[]string{"2024-03-11T00:00:00Z"}},
+		{"months", "2023-12-31T23:00:00Z", "2024-02-01T00:00:00Z", "month",
+			[]string{"2023-12-01T00:00:00Z", "2024-01-01T00:00:00Z"}},
+	}
+	for _, tt := range tests {
+		starts, err := bucketStarts(date(tt.from), date(tt.to), tt.interval)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(starts) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, starts, tt.want)
+			continue
+		}
+		for i := range starts {
+			if !starts[i].Equal(date(tt.want[i])) {
+				t.Errorf("%s: bucket %d starts at %s, want %s", tt.name, i, starts[i].Format(time.RFC3339), tt.want[i])
+			}
+		}
+	}
+}
+
+func TestBucketStartsInterval(t *testing.T) {
+	from, to := date("2024-03-10T00:00:00Z"), date("2024-03-11T00:00:00Z")
+	// the interval ends up in the query, only the known ones are accepted
+	for _, interval := range []string{"", "minute", "year", "Day", "day', now()) --", "day "} {
+		if _, err := bucketStarts(from, to, interval); !errors.Is(err, ErrValidation) {
+			t.Errorf("bucketStarts(%q) = %v, want ErrValidation", interval, err)
+		}
+	}
+	for _, interval := range StatsIntervals {
+		if _, err := bucketStarts(from, to, interval); err != nil {
+			t.Errorf("bucketStarts(%q) = %v", interval, err)
+		}
+	}
+}
+
+func TestBucketStartsLimit(t *testing.T) {
+	from := date("2024-01-01T00:00:00Z")
+
+	starts, err := bucketStarts(from, from.Add(maxBuckets*time.Hour), "hour")
+	if err != nil || len(starts) != maxBuckets {
+		t.Errorf("%d hours: got %d buckets, %v", maxBuckets, len(starts), err)
+	}
+	_, err = bucketStarts(from, from.Add((maxBuckets+1)*time.Hour), "hour")
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("%d hours: err = %v, want ErrValidation", maxBuckets+1, err)
+	}
+	_, err = bucketStarts(from, from.AddDate(100, 0, 0), "month")
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("100 years per month: err = %v, want ErrValidation", err)
+	}
+}
+
+func TestClickStats(t *testing.T) {
+	db := testDB(t)
+	clicks := ClickModel{DB: db}
+	user := &User{Email: "clicks@example.com", Password: "x"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	url := &Url{Original: "https://example.com", ShortUrl: "clicks", UserID: user.ID}
+	if err := db.Create(url).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []Click{
+		{UrlID: url.ID, CreatedAt: date("2024-03-10T08:00:00Z"), Referrer: "example.org", Device: DeviceMobile},
+		{UrlID: url.ID, CreatedAt: date("2024-03-10T20:00:00Z"), Device: DeviceMobile},
+		{UrlID: url.ID, CreatedAt: date("2024-03-12T09:00:00Z"), Country: "CH", Device: DeviceDesktop},
+		// outside of the period
+		{UrlID: url.ID, CreatedAt: date("2024-03-13T00:00:00Z")},
+	} {
+		if err := db.Create(&c).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := clicks.Stats(url.ID, date("2024-03-10T00:00:00Z"), date("2024-03-13T00:00:00Z"), "day")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{2, 0, 1}
+	if len(stats.Series) != len(want) {
+		t.Fatalf("series = %v, want %v clicks per day", stats.Series, want)
+	}
+	for i, n := range want {
+		if stats.Series[i].Clicks != n {
+			t.Errorf("day %d: %d clicks, want %d", i, stats.Series[i].Clicks, n)
+		}
+	}
+	if stats.Total != 3 {
+		t.Errorf("total = %d, want 3", stats.Total)
+	}
+	if len(stats.Referrers) != 2 || stats.Referrers[0] != (ClickCount{Name: "direct", Clicks: 2}) {
+		t.Errorf("referrers = %v, want 2 direct clicks first", stats.Referrers)
+	}
+
+	if _, err := clicks.Stats(uuid.New(), date("2024-03-13T00:00:00Z"), date("2024-03-10T00:00:00Z"), "day"); !errors.Is(err, ErrValidation) {
+		t.Errorf("Stats with since after until = %v, want ErrValidation", err)
+	}
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"os"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB connects to the PostgreSQL database in SHRINKSTER_TEST_DSN and
+// empties all tables. Tests using it are skipped without a database.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("SHRINKSTER_TEST_DSN")
+	if dsn == "" {
+		t.Skip("SHRINKSTER_TEST_DSN is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AutoMigrate(&User{}, &Role{}, &Url{}, &Token{}, &DeviceAuthorization{}, &DomainRule{}, &Report{}, &Email{}, &Click{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Exec("TRUNCATE users, roles, urls, tokens, device_authorizations, domain_rules, reports, emails, clicks CASCADE").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,194 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	DeviceStatusPending  = "pending"
+	DeviceStatusApproved = "approved"
+	DeviceStatusDenied   = "denied"
+
+	// userCodeAlphabet leaves out vowels and look-alike characters so that
+	// user codes are easy to type and never spell out words.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+)
+
+// DeviceAuthorization is a pending device authorization grant (RFC 8628).
+// The CLI holds the device code, the user enters the user code in the browser.
+type DeviceAuthorization struct {
+	gorm.Model
+	DeviceCodeHash []byte     `gorm:"not null;uniqueIndex"`
+	UserCode       string     `gorm:"type:varchar(9);not null;uniqueIndex"`
+	UserID         *uuid.UUID `gorm:"type:uuid"`
+	User           User       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Status         string     `gorm:"type:varchar(16);not null;default:'pending'"`
+	Expiry         time.Time  `gorm:"not null;index"`
+	LastPolledAt   time.Time
+}
+
+type DeviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type DeviceTokenRequest struct {
+	DeviceCode string `json:"device_code" validate:"required"`
+}
+
+type DeviceModel struct {
+	DB *gorm.DB
+}
+
+// New creates a new pending device authorization and returns it together
+// with the plaintext device code. Only the hash of the device code is stored.
+func (m DeviceModel) New(ttl time.Duration) (*DeviceAuthorization, string, error) {
+	randomBytes := make([]byte, 20)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	deviceCode := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(deviceCode))
+
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, "", err
+	}
+
+	device := &DeviceAuthorization{
+		DeviceCodeHash: hash[:],
+		UserCode:       userCode,
+		Status:         DeviceStatusPending,
+		Expiry:         time.Now().Add(ttl),
+	}
+	result := m.DB.Create(device)
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+
+	return device, deviceCode, nil
+}
+
+// GetByDeviceCode returns the device authorization for a plaintext device code.
+func (m DeviceModel) GetByDeviceCode(deviceCode string) (*DeviceAuthorization, error) {
+	device := new(DeviceAuthorization)
+	hash := sha256.Sum256([]byte(deviceCode))
+	result := m.DB.Where("device_code_hash = ?", hash[:]).First(&device)
+	if result.Error != nil {
+		return nil, dbError(result.Error, "device code")
+	}
+	return device, nil
+}
+
+// GetByUserCode returns the pending, unexpired device authorization for a user code.
+func (m DeviceModel) GetByUserCode(userCode string) (*DeviceAuthorization, error) {
+	device := new(DeviceAuthorization)
+	result := m.DB.Where("user_code = ? AND status = ? AND expiry > ?", NormalizeUserCode(userCode), DeviceStatusPending, time.Now()).First(&device)
+	if result.Error != nil {
+		return nil, dbError(result.Error, "user code")
+	}
+	return device, nil
+}
+
+// Approve grants the pending device authorization to the given user. A
+// device which has been decided on or has expired meanwhile is not found.
+func (m DeviceModel) Approve(device *DeviceAuthorization, userID uuid.UUID) error {
+	return m.decide(device, map[string]any{
+		"status":  DeviceStatusApproved,
+		"user_id": userID,
+	})
+}
+
+// Deny rejects the pending device authorization.
+func (m DeviceModel) Deny(device *DeviceAuthorization) error {
+	return m.decide(device, map[string]any{"status": DeviceStatusDenied})
+}
+
+// decide applies updates to device if it is still pending, so an approval
+// can't overwrite a denial or the other way round.
+func (m DeviceModel) decide(device *DeviceAuthorization, updates map[string]any) error {
+	result := m.DB.Model(&DeviceAuthorization{}).
+		Where("id = ? AND status = ? AND expiry > ?", device.ID, DeviceStatusPending, time.Now()).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return dbError(gorm.ErrRecordNotFound, "user code")
+	}
+	return nil
+}
+
+// Consume deletes an approved device authorization and returns the user it
+// was granted to. Only one of concurrent calls succeeds, the others get
+// ErrNotFound, so a grant is exchanged for a token once.
+func (m DeviceModel) Consume(device *DeviceAuthorization) (uuid.UUID, error) {
+	var grant struct {
+		UserID uuid.UUID
+	}
+	result := m.DB.Raw("DELETE FROM device_authorizations WHERE id = ? AND status = ? AND user_id IS NOT NULL RETURNING user_id",
+		device.ID, DeviceStatusApproved).Scan(&grant)
+	if result.Error != nil {
+		return uuid.Nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return uuid.Nil, dbError(gorm.ErrRecordNotFound, "device code")
+	}
+	return grant.UserID, nil
+}
+
+// Touch records a poll of the token endpoint.
+func (m DeviceModel) Touch(device *DeviceAuthorization) error {
+	result := m.DB.Model(device).Update("last_polled_at", time.Now())
+	return result.Error
+}
+
+// Delete removes a device authorization, it is called once a token has been issued.
+func (m DeviceModel) Delete(device *DeviceAuthorization) error {
+	result := m.DB.Unscoped().Delete(device)
+	return result.Error
+}
+
+// NormalizeUserCode uppercases a user code and restores the dash, so that
+// "bcdf ghjk" and "BCDF-GHJK" are treated the same.
+func NormalizeUserCode(userCode string) string {
+	code := strings.ToUpper(userCode)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	if len(code) != 8 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
+
+// generateUserCode returns a random user code like BDFG-HJKL. Every letter
+// is drawn uniformly from userCodeAlphabet.
+func generateUserCode() (string, error) {
+	size := big.NewInt(int64(len(userCodeAlphabet)))
+
+	var b strings.Builder
+	for i := 0; i < 8; i++ {
+		if i == 4 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", fmt.Errorf("could not generate user code: %w", err)
+		}
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
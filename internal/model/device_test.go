@@ -0,0 +1,73 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeviceDecisionIsFinal(t *testing.T) {
+	db := testDB(t)
+	devices := DeviceModel{DB: db}
+	user := &User{Email: "device@example.com", Password: "x"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	device, _, err := devices.New(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := devices.Deny(device); err != nil {
+		t.Fatal(err)
+	}
+	if err := devices.Approve(device, user.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Approve after Deny = %v, want ErrNotFound", err)
+	}
+	if _, err := devices.Consume(device); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Consume of a denied device = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDeviceConsumeOnce(t *testing.T) {
+	db := testDB(t)
+	devices := DeviceModel{DB: db}
+	user := &User{Email: "device@example.com", Password: "x"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	device, _, err := devices.New(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := devices.Approve(device, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := devices.Deny(device); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Deny after Approve = %v, want ErrNotFound", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			userID, err := devices.Consume(device)
+			if err == nil && userID == user.ID {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrNotFound) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if granted != 1 {
+		t.Errorf("the grant was consumed %d times, want once", granted)
+	}
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DomainRuleAllow = "allow"
+	DomainRuleBlock = "block"
+)
+
+// DomainRule puts a domain and all its subdomains on the allow- or blocklist.
+type DomainRule struct {
+	gorm.Model
+	Domain string `gorm:"type:varchar(255);not null;uniqueIndex" json:"domain"`
+	Kind   string `gorm:"type:varchar(16);not null" json:"kind"`
+	Note   string `gorm:"type:varchar(1024)" json:"note,omitempty"`
+}
+
+type DomainRuleRequest struct {
+	Domain string `json:"domain" validate:"required,fqdn"`
+	Kind   string `json:"kind" validate:"required,oneof=allow block"`
+	Note   string `json:"note,omitempty"`
+}
+
+type DomainRuleModel struct {
+	DB *gorm.DB
+}
+
+func (m DomainRuleModel) Create(req *DomainRuleRequest) (*DomainRule, error) {
+	if req.Kind != DomainRuleAllow && req.Kind != DomainRuleBlock {
+		return nil, Errorf(ErrValidation, "kind must be %q or %q", DomainRuleAllow, DomainRuleBlock)
+	}
+	domain := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(req.Domain)), ".")
+	if domain == "" {
+		return nil, Errorf(ErrValidation, "domain is required")
+	}
+
+	rule := &DomainRule{
+		Domain: domain,
+		Kind:   req.Kind,
+		Note:   req.Note,
+	}
+	result := m.DB.Create(rule)
+	if result.Error != nil {
+		return nil, dbError(result.Error, "domain")
+	}
+	return rule, nil
+}
+
+func (m DomainRuleModel) List() ([]DomainRule, error) {
+	var rules []DomainRule
+	result := m.DB.Order("domain").Find(&rules)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return rules, nil
+}
+
+func (m DomainRuleModel) Delete(id uint) error {
+	result := m.DB.Unscoped().Delete(&DomainRule{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return dbError(gorm.ErrRecordNotFound, "domain")
+	}
+	return nil
+}
+
+// Rules returns the allowed and blocked domains, it implements safety.RuleSource.
+func (m DomainRuleModel) Rules() (allow, block []string, err error) {
+	rules, err := m.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, rule := range rules {
+		switch rule.Kind {
+		case DomainRuleAllow:
+			allow = append(allow, rule.Domain)
+		case DomainRuleBlock:
+			block = append(block, rule.Domain)
+		}
+	}
+	return allow, block, nil
+}
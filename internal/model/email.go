@@ -0,0 +1,177 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	EmailStatusPending = "pending"
+	EmailStatusSent    = "sent"
+	EmailStatusFailed  = "failed"
+
+	// MaxEmailAttempts is the number of delivery attempts before an email is marked as failed.
+	MaxEmailAttempts = 8
+	emailBackoffBase = time.Minute
+	emailBackoffMax  = 6 * time.Hour
+	// emailLease is how long a claimed email is hidden from other workers.
+	emailLease = 5 * time.Minute
+)
+
+// Email is a message in the outbox. It is rendered from Template and Data
+// when it is sent, failed deliveries are retried with exponential backoff.
+// Data can hold plaintext tokens, it is cleared once the email is sent.
+// Failed emails keep it until an admin retries or discards them.
+type Email struct {
+	gorm.Model
+	Recipient     string    `gorm:"type:varchar(255);not null"`
+	Template      string    `gorm:"type:varchar(255);not null"`
+	Data          []byte    `gorm:"type:jsonb"`
+	Status        string    `gorm:"type:varchar(16);not null;default:'pending';index"`
+	Attempts      int       `gorm:"default:0"`
+	NextAttemptAt time.Time `gorm:"not null;index"`
+	LastError     string    `gorm:"type:varchar(2048)"`
+	SentAt        *time.Time
+}
+
+// TemplateData decodes the data the email is rendered with.
+func (e *Email) TemplateData() (map[string]any, error) {
+	data := map[string]any{}
+	if len(e.Data) == 0 {
+		return data, nil
+	}
+	err := json.Unmarshal(e.Data, &data)
+	return data, err
+}
+
+type EmailModel struct {
+	DB *gorm.DB
+}
+
+// Enqueue puts an email into the outbox, it is sent by the mail worker.
+func (m EmailModel) Enqueue(recipient, template string, data map[string]any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	email := &Email{
+		Recipient:     recipient,
+		Template:      template,
+		Data:          encoded,
+		Status:        EmailStatusPending,
+		NextAttemptAt: time.Now(),
+	}
+	result := m.DB.Create(email)
+	return result.Error
+}
+
+// Claim returns up to limit due emails. They are leased for a few minutes,
+// so concurrent workers don't send them twice.
+func (m EmailModel) Claim(limit int) ([]Email, error) {
+	var emails []Email
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", EmailStatusPending, time.Now()).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&emails)
+		if result.Error != nil {
+			return result.Error
+		}
+		if len(emails) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(emails))
+		for i, email := range emails {
+			ids[i] = email.ID
+		}
+		result = tx.Model(&Email{}).Where("id IN ?", ids).Update("next_attempt_at", time.Now().Add(emailLease))
+		return result.Error
+	})
+	return emails, err
+}
+
+// MarkSent records a successful delivery and clears the data of the email.
+func (m EmailModel) MarkSent(email *Email) error {
+	now := time.Now()
+	result := m.DB.Model(email).Updates(map[string]any{
+		"data":       nil,
+		"status":     EmailStatusSent,
+		"attempts":   email.Attempts + 1,
+		"sent_at":    &now,
+		"last_error": "",
+	})
+	return result.Error
+}
+
+// MarkFailed records a failed delivery. The email is retried later unless
+// it has reached MaxEmailAttempts.
+func (m EmailModel) MarkFailed(email *Email, sendErr error) error {
+	attempts := email.Attempts + 1
+	updates := map[string]any{
+		"attempts":   attempts,
+		"last_error": truncate(sendErr.Error(), 2048),
+	}
+	if attempts >= MaxEmailAttempts {
+		updates["status"] = EmailStatusFailed
+	} else {
+		backoff := emailBackoffBase << (attempts - 1)
+		if backoff > emailBackoffMax || backoff <= 0 {
+			backoff = emailBackoffMax
+		}
+		updates["next_attempt_at"] = time.Now().Add(backoff)
+	}
+
+	result := m.DB.Model(email).Updates(updates)
+	return result.Error
+}
+
+// ListFailed returns the emails which could not be delivered, newest first.
+func (m EmailModel) ListFailed() ([]Email, error) {
+	var emails []Email
+	result := m.DB.Where("status = ?", EmailStatusFailed).Order("updated_at DESC").Limit(200).Find(&emails)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return emails, nil
+}
+
+// Retry puts a failed email back into the queue.
+func (m EmailModel) Retry(id uint) error {
+	result := m.DB.Model(&Email{}).Where("id = ? AND status = ?", id, EmailStatusFailed).Updates(map[string]any{
+		"status":          EmailStatusPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return dbError(gorm.ErrRecordNotFound, "failed email")
+	}
+	return nil
+}
+
+// Discard deletes a failed email together with its data.
+func (m EmailModel) Discard(id uint) error {
+	result := m.DB.Unscoped().Where("id = ? AND status = ?", id, EmailStatusFailed).Delete(&Email{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return dbError(gorm.ErrRecordNotFound, "failed email")
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEmailFailureAndRetry(t *testing.T) {
+	emails := EmailModel{DB: testDB(t)}
+
+	err := emails.Enqueue("user@example.com", "password_reset.tmpl.html", map[string]any{"resetToken": "TOKEN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var email Email
+	for i := 0; i < MaxEmailAttempts; i++ {
+		// skip the backoff of the previous attempt
+		emails.DB.Model(&Email{}).Where("1 = 1").Update("next_attempt_at", time.Now())
+		claimed, err := emails.Claim(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(claimed) != 1 {
+			t.Fatalf("attempt %d: claimed %d emails, want 1", i+1, len(claimed))
+		}
+		email = claimed[0]
+		if err := emails.MarkFailed(&email, errors.New("connection refused")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failed, err := emails.ListFailed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].Attempts != MaxEmailAttempts || failed[0].LastError != "connection refused" {
+		t.Fatalf("failed emails = %+v, want the email after %d attempts", failed, MaxEmailAttempts)
+	}
+	if data, _ := failed[0].TemplateData(); data["resetToken"] != "TOKEN" {
+		t.Fatalf("failed email lost its data: %v", data)
+	}
+
+	if err := emails.Retry(failed[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := emails.Claim(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].Attempts != 0 {
+		t.Fatalf("claimed %+v after retry, want the email with 0 attempts", claimed)
+	}
+	if err := emails.MarkSent(&claimed[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent Email
+	emails.DB.First(&sent, claimed[0].ID)
+	if sent.Status != EmailStatusSent || sent.Data != nil {
+		t.Errorf("sent email has status %q and data %q, want sent without data", sent.Status, sent.Data)
+	}
+	if err := emails.Retry(sent.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Retry of a sent email = %v, want ErrNotFound", err)
+	}
+}
+
+func TestEmailDiscard(t *testing.T) {
+	emails := EmailModel{DB: testDB(t)}
+
+	err := emails.Enqueue("user@example.com", "welcome.tmpl.html", map[string]any{"activationToken": "TOKEN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var email Email
+	emails.DB.First(&email)
+
+	if err := emails.Discard(email.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Discard of a pending email = %v, want ErrNotFound", err)
+	}
+	emails.DB.Model(&email).Update("status", EmailStatusFailed)
+	if err := emails.Discard(email.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	emails.DB.Unscoped().Model(&Email{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d emails left after discarding, want 0", count)
+	}
+}
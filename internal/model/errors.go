@@ -0,0 +1,103 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// The kinds of errors returned by the models. Check them with errors.Is.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrValidation = errors.New("invalid input")
+	ErrForbidden  = errors.New("forbidden")
+)
+
+// Error is an error whose message can be shown to the user. Kind is one of
+// the error kinds above, Err the cause if there is one.
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// Errorf returns an *Error of the given kind.
+func Errorf(kind error, format string, a ...any) error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+// FieldErrors are the validation errors of a request by field name. They
+// are of kind ErrValidation.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	msgs := make([]string, len(fields))
+	for i, field := range fields {
+		msgs[i] = field + " " + e[field]
+	}
+	return strings.Join(msgs, ", ")
+}
+
+func (e FieldErrors) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// Postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgUniqueViolation = "23505"
+	pgValueTooLong    = "22001"
+)
+
+// dbError turns missing records and unique violations into a not found or
+// conflict error about what. Other errors are returned unchanged.
+func dbError(err error, what string) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return &Error{Kind: ErrNotFound, Message: what + " not found", Err: err}
+	case pgCode(err) == pgUniqueViolation:
+		return &Error{Kind: ErrConflict, Message: what + " already exists", Err: err}
+	}
+	return err
+}
+
+// pgCode returns the Postgres error code of err, if it has one.
+func pgCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// pgConstraint returns the name of the constraint err violated, if any.
+func pgConstraint(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.ConstraintName
+	}
+	return ""
+}
@@ -13,18 +13,30 @@ const (
 )
 
 type Models struct {
-	Urls   UrlModel
-	Users  UserModel
-	Roles  RoleModel
-	Tokens TokenModel
+	Urls     UrlModel
+	Users    UserModel
+	Roles    RoleModel
+	Tokens   TokenModel
+	Devices  DeviceModel
+	Domains  DomainRuleModel
+	Reports  ReportModel
+	Emails   EmailModel
+	Clicks   ClickModel
+	Sessions SessionModel
 }
 
 func NewModels(db *gorm.DB) Models {
 	return Models{
-		Users:  UserModel{DB: db},
-		Urls:   UrlModel{DB: db},
-		Roles:  RoleModel{DB: db},
-		Tokens: TokenModel{DB: db},
+		Users:    UserModel{DB: db},
+		Urls:     UrlModel{DB: db},
+		Roles:    RoleModel{DB: db},
+		Tokens:   TokenModel{DB: db},
+		Devices:  DeviceModel{DB: db},
+		Domains:  DomainRuleModel{DB: db},
+		Reports:  ReportModel{DB: db},
+		Emails:   EmailModel{DB: db},
+		Clicks:   ClickModel{DB: db},
+		Sessions: SessionModel{DB: db},
 	}
 }
 
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusResolved  = "resolved"
+	ReportStatusDismissed = "dismissed"
+)
+
+// ReportReasons are the reasons a visitor can choose from when reporting a link.
+var ReportReasons = []string{"phishing", "malware", "spam", "illegal content", "other"}
+
+// Report is an abuse report for a short link.
+type Report struct {
+	gorm.Model
+	UrlID         uuid.UUID  `gorm:"type:uuid;not null;index" json:"url_id"`
+	Url           Url        `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Reason        string     `gorm:"type:varchar(64);not null" json:"reason"`
+	Details       string     `gorm:"type:varchar(2048)" json:"details,omitempty"`
+	ReporterEmail string     `gorm:"type:varchar(255)" json:"reporter_email,omitempty"`
+	ReporterIP    string     `gorm:"type:varchar(64)" json:"-"`
+	Status        string     `gorm:"type:varchar(16);not null;default:'open';index" json:"status"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+}
+
+type ReportRequest struct {
+	ShortCode     string `form:"short_code" json:"short_code" validate:"required"`
+	Reason        string `form:"reason" json:"reason" validate:"required"`
+	Details       string `form:"details" json:"details,omitempty" validate:"max=2048"`
+	ReporterEmail string `form:"email" json:"email,omitempty" validate:"omitempty,email"`
+}
+
+type ReportModel struct {
+	DB *gorm.DB
+}
+
+// Create files a new report for a url.
+func (m ReportModel) Create(url *Url, req *ReportRequest, reporterIP string) (*Report, error) {
+	if !isReportReason(req.Reason) {
+		return nil, Errorf(ErrValidation, "invalid reason")
+	}
+
+	report := &Report{
+		UrlID:         url.ID,
+		Reason:        req.Reason,
+		Details:       req.Details,
+		ReporterEmail: req.ReporterEmail,
+		ReporterIP:    reporterIP,
+		Status:        ReportStatusOpen,
+	}
+	result := m.DB.Create(report)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return report, nil
+}
+
+// ListOpen returns all open reports with their urls, oldest first.
+func (m ReportModel) ListOpen() ([]Report, error) {
+	var reports []Report
+	result := m.DB.Preload("Url").Where("status = ?", ReportStatusOpen).Order("created_at").Find(&reports)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return reports, nil
+}
+
+// Get returns a single report.
+func (m ReportModel) Get(id uint) (*Report, error) {
+	report := new(Report)
+	result := m.DB.First(&report, id)
+	if result.Error != nil {
+		return nil, dbError(result.Error, "report")
+	}
+	return report, nil
+}
+
+// SetStatus closes a single report.
+func (m ReportModel) SetStatus(report *Report, status string) error {
+	result := m.DB.Model(report).Updates(map[string]any{
+		"status":      status,
+		"resolved_at": time.Now(),
+	})
+	return result.Error
+}
+
+// ResolveAllForUrl closes all open reports of a url, e.g. after it has been disabled.
+func (m ReportModel) ResolveAllForUrl(urlID uuid.UUID) error {
+	result := m.DB.Model(&Report{}).Where("url_id = ? AND status = ?", urlID, ReportStatusOpen).Updates(map[string]any{
+		"status":      ReportStatusResolved,
+		"resolved_at": time.Now(),
+	})
+	return result.Error
+}
+
+func isReportReason(reason string) bool {
+	for _, r := range ReportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
@@ -12,3 +12,14 @@ type Session struct {
 	Data   []byte    `gorm:"not null"`
 	Expiry time.Time `gorm:"not null;index"`
 }
+
+type SessionModel struct {
+	DB *gorm.DB
+}
+
+// Count returns the number of sessions which haven't expired.
+func (m SessionModel) Count() (int64, error) {
+	var n int64
+	result := m.DB.Model(&Session{}).Where("expiry > ?", time.Now()).Count(&n)
+	return n, result.Error
+}
@@ -4,7 +4,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base32"
-	"fmt"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,13 +14,15 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeEmailChange    = "email-change"
 )
 
 // ValidateTokenPlaintext validates a token plaintext.
 // token must not be empty and be 26 bytes long.
 func ValidateTokenPlaintext(tokenPlaintext string) error {
 	if len(tokenPlaintext) != 26 {
-		return fmt.Errorf("token must be 26 bytes long")
+		return Errorf(ErrValidation, "token must be 26 bytes long")
 	}
 	return nil
 }
@@ -85,11 +87,14 @@ func (m TokenModel) DeleteAllForUser(scope string, userID uuid.UUID) error {
 	return nil
 }
 
-// GetUserID returns a user for a given token.
+// GetUserID returns a user for a given token. Expired tokens are ignored.
 func (m TokenModel) GetUserID(scope, token string) (uuid.UUID, error) {
 	tokenObj := new(Token)
 	tokenHash := sha256.Sum256([]byte(token))
-	result := m.DB.Where("scope = ? AND hash = ?", scope, tokenHash[:]).First(&tokenObj)
+	result := m.DB.Where("scope = ? AND hash = ? AND expiry > ?", scope, tokenHash[:], time.Now()).First(&tokenObj)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return uuid.UUID{}, &Error{Kind: ErrValidation, Message: "invalid or expired token", Err: result.Error}
+	}
 	if result.Error != nil {
 		return uuid.UUID{}, result.Error
 	}
@@ -1,7 +1,7 @@
 package model
 
 import (
-	"fmt"
+	"errors"
 	"math/rand"
 	"strings"
 	"time"
@@ -12,6 +12,26 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	ErrUserIDRequired   = Errorf(ErrValidation, "user id is required")
+	ErrExpiryInPast     = Errorf(ErrValidation, "expires_at must be in the future")
+	ErrShortCodeTooLong = Errorf(ErrValidation, "short_url is too long")
+)
+
+// ExistingUrlError is returned by Create if the user has already shortened
+// the url. It is of kind ErrConflict.
+type ExistingUrlError struct {
+	Url Url
+}
+
+func (e *ExistingUrlError) Error() string {
+	return "url already exists"
+}
+
+func (e *ExistingUrlError) Is(target error) bool {
+	return target == ErrConflict
+}
+
 // UrlModel is a struct which wraps the connection pool.
 type UrlModel struct {
 	DB *gorm.DB
@@ -20,18 +40,44 @@ type UrlModel struct {
 type Url struct {
 	gorm.Model
 	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primary_key" json:"id,omitempty"`
-	Original  string    `gorm:"type:varchar(2048);not null;uniqueIndex" json:"original"`
+	Original  string    `gorm:"type:varchar(2048);not null;uniqueIndex:idx_urls_user_original" json:"original"`
 	ShortUrl  string    `gorm:"type:varchar(256);not null;uniqueIndex" json:"short_url"`
 	QRCodeURL string    `gorm:"type:varchar(2048)" json:"qr_code_url,omitempty"`
-	UserID    uuid.UUID `gorm:"type:uuid" json:"user_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_urls_user_original" json:"user_id"`
 	User      User      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	Visits    int       `gorm:"default:0" json:"visits"`
+	// Disabled links show a warning page instead of redirecting.
+	Disabled       bool   `gorm:"default:false" json:"disabled"`
+	DisabledReason string `gorm:"type:varchar(1024)" json:"disabled_reason,omitempty"`
+	// ExpiresAt is optional, expired links no longer redirect.
+	ExpiresAt          *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	ExpiryReminderSent bool       `gorm:"default:false" json:"-"`
+}
+
+// OwnerID returns the id of the user the url belongs to.
+func (u *Url) OwnerID() uuid.UUID {
+	return u.UserID
+}
+
+// Expired reports whether the url has an expiry date in the past.
+func (u *Url) Expired() bool {
+	return u.ExpiresAt != nil && u.ExpiresAt.Before(time.Now())
 }
 
 type UrlCreateRequest struct {
-	Original  string    `json:"original" validate:"required,url"`
-	ShortCode string    `json:"short_code,omitempty" validate:"alphanum,min=3,max=11"`
-	UserID    uuid.UUID `json:"user_id"`
+	Original  string `json:"original" validate:"required,url"`
+	ShortCode string `json:"short_code,omitempty" validate:"omitempty,alphanum,min=3,max=11"`
+	// UserID is the owner. It is never read from the request, the handlers
+	// set it.
+	UserID    uuid.UUID  `json:"-"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// UrlUpdateRequest replaces the destination and expiry of a url. Without
+// ExpiresAt the url doesn't expire.
+type UrlUpdateRequest struct {
+	Original  string     `json:"original" validate:"required,url"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 type UrlResponse struct {
@@ -45,13 +91,23 @@ type UrlByUserRequest struct {
 }
 
 type UrlByUserResponse struct {
-	ID        uuid.UUID `json:"id"`
-	Original  string    `json:"original"`
-	ShortUrl  string    `json:"short_url"`
-	Visits    int       `json:"visits"`
-	QRCodeURL string    `json:"qr_code_url,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        uuid.UUID  `json:"id"`
+	Original  string     `json:"original"`
+	ShortUrl  string     `json:"short_url"`
+	Visits    int        `json:"visits"`
+	QRCodeURL string     `json:"qr_code_url,omitempty"`
+	Disabled  bool       `json:"disabled"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// UrlInfoResponse are the details of a single url.
+type UrlInfoResponse struct {
+	UrlByUserResponse
+	FullUrl        string       `json:"full_url"`
+	DisabledReason string       `json:"disabled_reason,omitempty"`
+	Clicks         ClickSummary `json:"clicks"`
 }
 
 type UrlDeleteRequest struct {
@@ -66,12 +122,9 @@ func (u *UrlModel) Create(urlReq *UrlCreateRequest) (Url, error) {
 	url := new(Url)
 
 	if urlReq.UserID == uuid.Nil {
-		return Url{}, fmt.Errorf("user id is required")
+		return Url{}, ErrUserIDRequired
 	}
 
-	if strings.Contains(urlReq.Original, "shrink.ch/s/") {
-		return Url{}, fmt.Errorf("url cannot start with shrink.ch/s/")
-	}
 	if urlReq.ShortCode != "" {
 		url.ShortUrl = strings.ToLower(url2.PathEscape(urlReq.ShortCode))
 	} else {
@@ -79,23 +132,61 @@ func (u *UrlModel) Create(urlReq *UrlCreateRequest) (Url, error) {
 		url.ShortUrl = id
 	}
 
+	if urlReq.ExpiresAt != nil && urlReq.ExpiresAt.Before(time.Now()) {
+		return Url{}, ErrExpiryInPast
+	}
+
 	url.Original = urlReq.Original
 	url.UserID = urlReq.UserID
+	url.ExpiresAt = urlReq.ExpiresAt
 
 	result := u.DB.Create(url)
 	if result.Error != nil {
-		if strings.Contains(result.Error.Error(), "duplicate key value violates unique constraint") {
-			return Url{}, fmt.Errorf("url already exists")
+		if pgCode(result.Error) == pgValueTooLong {
+			return Url{}, ErrShortCodeTooLong
 		}
-		if strings.Contains(result.Error.Error(), "value too long for type character") {
-			return Url{}, fmt.Errorf("short_url is too long")
+		if pgConstraint(result.Error) == "idx_urls_user_original" {
+			return Url{}, u.existing(url.UserID, url.Original, result.Error)
 		}
-		return Url{}, result.Error
+		return Url{}, dbError(result.Error, "url")
 	}
 
 	return *url, nil
 }
 
+// existing returns an *ExistingUrlError with the url of the user pointing to
+// original, or dbError(err) if it can't be found.
+func (u *UrlModel) existing(userID uuid.UUID, original string, err error) error {
+	existing := new(Url)
+	result := u.DB.Where("user_id = ? AND original = ?", userID, original).First(existing)
+	if result.Error != nil {
+		return dbError(err, "url")
+	}
+	return &ExistingUrlError{Url: *existing}
+}
+
+// Update changes the destination and expiry of a url. A new expiry date
+// gets a new reminder.
+func (u *UrlModel) Update(url *Url, urlReq *UrlUpdateRequest) error {
+	if urlReq.ExpiresAt != nil && urlReq.ExpiresAt.Before(time.Now()) {
+		return ErrExpiryInPast
+	}
+
+	result := u.DB.Model(url).Updates(map[string]any{
+		"original":             urlReq.Original,
+		"expires_at":           urlReq.ExpiresAt,
+		"expiry_reminder_sent": false,
+	})
+	if result.Error != nil {
+		return dbError(result.Error, "url")
+	}
+
+	url.Original = urlReq.Original
+	url.ExpiresAt = urlReq.ExpiresAt
+	url.ExpiryReminderSent = false
+	return nil
+}
+
 // SetQRCodeURL sets the QRCodeURL for a given url
 func (u *UrlModel) SetQRCodeURL(url *Url, qrCodeURL string) error {
 	result := u.DB.Model(url).Update("qr_code_url", qrCodeURL)
@@ -106,18 +197,102 @@ func (u *UrlModel) SetQRCodeURL(url *Url, qrCodeURL string) error {
 	return nil
 }
 
-func (u *UrlModel) GetRedirect(shortUrl string) (Url, error) {
+// GetRedirect returns the url for a short url and records the click, unless
+// the url is disabled or expired.
+func (u *UrlModel) GetRedirect(shortUrl string, click Click) (Url, error) {
+	url, err := u.byShortUrl(shortUrl)
+	if err != nil {
+		return Url{}, err
+	}
+
+	if !url.Disabled && !url.Expired() {
+		click.UrlID = url.ID
+		go func() {
+			u.DB.Model(&url).Update("visits", gorm.Expr("visits + 1"))
+			u.DB.Create(&click)
+		}()
+	}
+
+	return *url, nil
+}
+
+// GetByShortUrl returns the url for a given short url without counting a visit.
+func (u *UrlModel) GetByShortUrl(shortUrl string) (*Url, error) {
+	return u.byShortUrl(shortUrl)
+}
+
+// byShortUrl looks up a short code. Custom codes are stored in lower case,
+// so they match in any case, generated codes only as they are.
+func (u *UrlModel) byShortUrl(shortUrl string) (*Url, error) {
 	url := new(Url)
-	result := u.DB.Where("short_url = ?", shortUrl).First(&url)
+	result := u.DB.Where("short_url = ?", shortUrl).First(url)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) && strings.ToLower(shortUrl) != shortUrl {
+		result = u.DB.Where("short_url = ?", strings.ToLower(shortUrl)).First(url)
+	}
 	if result.Error != nil {
-		return Url{}, result.Error
+		return nil, dbError(result.Error, "url")
 	}
+	return url, nil
+}
 
-	go func() {
-		u.DB.Model(&url).Update("visits", gorm.Expr("visits + 1"))
-	}()
+// ListDisabled returns the disabled urls, most recently changed first.
+func (u *UrlModel) ListDisabled() ([]*Url, error) {
+	var urls []*Url
+	result := u.DB.Where("disabled = ?", true).Order("updated_at DESC").Find(&urls)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return urls, nil
+}
 
-	return *url, nil
+// SetDisabled disables or re-enables a url. Disabled urls are kept, but
+// show a warning page instead of redirecting.
+func (u *UrlModel) SetDisabled(url *Url, disabled bool, reason string) error {
+	if !disabled {
+		reason = ""
+	}
+	url.Disabled = disabled
+	url.DisabledReason = reason
+	result := u.DB.Model(url).Updates(map[string]any{
+		"disabled":        disabled,
+		"disabled_reason": reason,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// ExpiringBefore returns the urls which expire before t and whose owner
+// has not been reminded yet.
+func (u *UrlModel) ExpiringBefore(t time.Time) ([]Url, error) {
+	var urls []Url
+	result := u.DB.Preload("User").
+		Where("expires_at IS NOT NULL AND expires_at > ? AND expires_at <= ? AND expiry_reminder_sent = ?", time.Now(), t, false).
+		Find(&urls)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return urls, nil
+}
+
+// ExpiredBetween returns the urls of a user which expired in (from, to].
+func (u *UrlModel) ExpiredBetween(userID uuid.UUID, from, to time.Time) ([]Url, error) {
+	var urls []Url
+	result := u.DB.Where("user_id = ? AND expires_at > ? AND expires_at <= ?", userID, from, to).Order("expires_at").Find(&urls)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return urls, nil
+}
+
+// SetExpiryReminderSent records that the owner has been reminded of the expiry.
+func (u *UrlModel) SetExpiryReminderSent(url *Url) error {
+	result := u.DB.Model(url).Update("expiry_reminder_sent", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
 }
 
 // GetUrlByUser returns all URLs for a given user
@@ -128,21 +303,50 @@ func (u *UrlModel) GetUrlByUser(userId uuid.UUID) (*[]UrlByUserResponse, error)
 		return nil, result.Error
 	}
 
+	resp := toUrlByUserResponses(urls)
+	return &resp, nil
+}
+
+// GetUrlByUserPage returns a page of the URLs of a user, oldest first, and
+// the total number of URLs the user has.
+func (u *UrlModel) GetUrlByUserPage(userId uuid.UUID, offset, limit int) ([]UrlByUserResponse, int64, error) {
+	var total int64
+	result := u.DB.Model(&Url{}).Where("user_id = ?", userId).Count(&total)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	var urls []Url
+	result = u.DB.Where("user_id = ?", userId).Order("created_at, id").Offset(offset).Limit(limit).Find(&urls)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return toUrlByUserResponses(urls), total, nil
+}
+
+func toUrlByUserResponses(urls []Url) []UrlByUserResponse {
 	resp := []UrlByUserResponse{}
 	for _, url := range urls {
-		shortUrl, _ := url2.PathUnescape(url.ShortUrl)
-		resp = append(resp, UrlByUserResponse{
-			ID:        url.ID,
-			Original:  url.Original,
-			ShortUrl:  shortUrl,
-			Visits:    url.Visits,
-			QRCodeURL: url.QRCodeURL,
-			CreatedAt: url.CreatedAt,
-			UpdatedAt: url.UpdatedAt,
-		})
+		resp = append(resp, url.Response())
 	}
+	return resp
+}
 
-	return &resp, nil
+// Response returns the url as it is sent to its owner.
+func (u *Url) Response() UrlByUserResponse {
+	shortUrl, _ := url2.PathUnescape(u.ShortUrl)
+	return UrlByUserResponse{
+		ID:        u.ID,
+		Original:  u.Original,
+		ShortUrl:  shortUrl,
+		Visits:    u.Visits,
+		QRCodeURL: u.QRCodeURL,
+		Disabled:  u.Disabled,
+		ExpiresAt: u.ExpiresAt,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	}
 }
 
 func (u *UrlModel) Delete(urlUUID uuid.UUID) error {
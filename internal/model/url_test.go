@@ -0,0 +1,72 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetByShortUrlCase(t *testing.T) {
+	db := testDB(t)
+	urls := UrlModel{DB: db}
+	user := &User{Email: "urls@example.com", Password: "x"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"AbC123", "abc123", "promo"} {
+		url := &Url{Original: "https://example.com/" + code, ShortUrl: code, UserID: user.ID}
+		if err := db.Create(url).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"AbC123", "AbC123"},
+		{"abc123", "abc123"},
+		{"ABC123", "abc123"},
+		{"PROMO", "promo"},
+		{"Promo", "promo"},
+		{"aBc123x", ""},
+	}
+	for _, tt := range tests {
+		url, err := urls.GetByShortUrl(tt.code)
+		if tt.want == "" {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetByShortUrl(%q) = %v, want ErrNotFound", tt.code, err)
+			}
+			continue
+		}
+		if err != nil || url.ShortUrl != tt.want {
+			t.Errorf("GetByShortUrl(%q) = %v, %v, want %s", tt.code, url, err, tt.want)
+		}
+	}
+}
+
+func TestListDisabled(t *testing.T) {
+	db := testDB(t)
+	urls := UrlModel{DB: db}
+	user := &User{Email: "urls@example.com", Password: "x"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	disabled := &Url{Original: "https://example.com/a", ShortUrl: "a", UserID: user.ID}
+	enabled := &Url{Original: "https://example.com/b", ShortUrl: "b", UserID: user.ID}
+	for _, url := range []*Url{disabled, enabled} {
+		if err := db.Create(url).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := urls.SetDisabled(disabled, true, "phishing"); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := urls.ListDisabled()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != disabled.ID || list[0].DisabledReason != "phishing" {
+		t.Errorf("ListDisabled = %v, want only the disabled url", list)
+	}
+}
@@ -1,7 +1,8 @@
 package model
 
 import (
-	"fmt"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,6 +11,52 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	// MaxFailedLogins is the number of consecutive failed logins after which an account gets locked.
+	MaxFailedLogins = 5
+	// lockoutBase is the duration of the first lockout, every further lockout doubles it.
+	lockoutBase = 15 * time.Minute
+	lockoutMax  = 24 * time.Hour
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrNoUser is returned if a request has no authenticated user.
+	ErrNoUser = errors.New("not authenticated")
+)
+
+// CredentialsError is returned by Login for a wrong password or a locked
+// account, the two are not told apart. LockedUntil is set if the attempt
+// locked the account, so the owner can be notified.
+type CredentialsError struct {
+	LockedUntil *time.Time
+}
+
+func (e *CredentialsError) Error() string {
+	return ErrInvalidCredentials.Error()
+}
+
+func (e *CredentialsError) Is(target error) bool {
+	return target == ErrInvalidCredentials
+}
+
+const (
+	DigestOff     = "off"
+	DigestWeekly  = "weekly"
+	DigestMonthly = "monthly"
+)
+
+// DigestFrequencies are the choices for the link performance digest email.
+var DigestFrequencies = []string{DigestOff, DigestWeekly, DigestMonthly}
+
+// DigestPeriod returns the start of the period a digest sent at now covers.
+func DigestPeriod(frequency string, now time.Time) time.Time {
+	if frequency == DigestMonthly {
+		return now.AddDate(0, -1, 0)
+	}
+	return now.AddDate(0, 0, -7)
+}
+
 type UserModel struct {
 	DB *gorm.DB
 }
@@ -19,16 +66,29 @@ type User struct {
 	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primary_key"`
 	Name      string    `gorm:"type:varchar(255)"`
 	Email     string    `gorm:"not null;uniqueIndex"`
-	Password  string    `gorm:"not null"`
+	Password  string    `gorm:"not null" json:"-"` // the bcrypt hash is never serialized
 	Role      string    `gorm:"default:'user'"`
 	Activated bool      `gorm:"default:false"`
+	// FailedLogins counts consecutive failed logins, it is reset on success.
+	FailedLogins int        `gorm:"default:0"`
+	LockedUntil  *time.Time `gorm:"index"`
+	// PendingEmail holds a new email address until the user confirms it.
+	PendingEmail string `gorm:"type:varchar(255)"`
+	// DigestFrequency is one of the DigestFrequencies, digests are opt-in.
+	DigestFrequency string `gorm:"type:varchar(16);not null;default:'off'"`
+	LastDigestAt    *time.Time
+}
+
+// IsLocked reports whether the account is currently locked.
+func (u *User) IsLocked() bool {
+	return u.LockedUntil != nil && u.LockedUntil.After(time.Now())
 }
 
 type UserRegisterReq struct {
 	Email           string `json:"email" validate:"required,email"`
 	Name            string `json:"name" validate:"required"`
 	Password        string `json:"password" validate:"required,min=8,max=72"`
-	PasswordConfirm string `json:"password_confirm" validate:"required,min=8,max=72"`
+	PasswordConfirm string `json:"password_confirm" validate:"required,eqfield=Password"`
 }
 
 type UserResponse struct {
@@ -41,27 +101,226 @@ type UserResponse struct {
 
 type UserLoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type PasswordUpdateRequest struct {
+	Token    string `json:"token" validate:"required"`
 	Password string `json:"password" validate:"required,min=8,max=72"`
 }
 
+type EmailChangeRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type PreferencesRequest struct {
+	DigestFrequency string `json:"digest_frequency" validate:"required,oneof=off weekly monthly"`
+}
+
 type UserLoginResponse struct {
 	ID    uuid.UUID `json:"id"`
 	Email string    `json:"email"`
 	Token string    `json:"token"`
 }
 
+// Login checks the credentials of a user. Failed attempts are counted per
+// account, every MaxFailedLogins consecutive failures lock the account for
+// an exponentially growing duration. While an account is locked the
+// password isn't checked at all.
 func (u *UserModel) Login(email, password string) (*User, error) {
 	user := new(User)
 	result := u.DB.Where("email = ?", email).First(&user)
 	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			checkPasswordHash(password, dummyHash())
+			return nil, ErrInvalidCredentials
+		}
 		return nil, result.Error
 	}
+	if user.IsLocked() {
+		checkPasswordHash(password, dummyHash())
+		return nil, &CredentialsError{}
+	}
 	if !checkPasswordHash(password, user.Password) {
-		return nil, fmt.Errorf("invalid password")
+		return nil, u.recordFailedLogin(user.ID)
+	}
+
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		result = u.DB.Model(user).Updates(map[string]any{"failed_logins": 0, "locked_until": nil})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+	}
+	return user, nil
+}
+
+// recordFailedLogin increments the failed login counter and locks the
+// account if the threshold has been reached. The counter is incremented in
+// the database, so concurrent attempts can't skip the threshold.
+func (u *UserModel) recordFailedLogin(id uuid.UUID) error {
+	var counter struct {
+		FailedLogins int
+		LockedUntil  *time.Time
+	}
+	result := u.DB.Raw("UPDATE users SET failed_logins = failed_logins + 1 WHERE id = ? RETURNING failed_logins, locked_until", id).Scan(&counter)
+	if result.Error != nil {
+		return result.Error
+	}
+	lockout := lockoutAfter(counter.FailedLogins)
+	if lockout == 0 {
+		return &CredentialsError{}
+	}
+	now := time.Now()
+	until := now.Add(lockout)
+	result = u.DB.Model(&User{}).Where("id = ?", id).Update("locked_until", until)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	// the owner has already been notified of a lock which is extended
+	if counter.LockedUntil != nil && counter.LockedUntil.After(now) {
+		return &CredentialsError{}
+	}
+	return &CredentialsError{LockedUntil: &until}
+}
+
+// lockoutAfter returns how long an account is locked after failures
+// consecutive failed logins, or 0 if it isn't locked.
+func lockoutAfter(failures int) time.Duration {
+	if failures <= 0 || failures%MaxFailedLogins != 0 {
+		return 0
+	}
+	lockout := lockoutBase << (failures/MaxFailedLogins - 1)
+	if lockout > lockoutMax || lockout <= 0 {
+		lockout = lockoutMax
+	}
+	return lockout
+}
+
+// Unlock removes the lock from an account and resets the failed login counter.
+func (u *UserModel) Unlock(id uuid.UUID) error {
+	result := u.DB.Model(&User{}).Where("id = ?", id).Updates(map[string]any{"failed_logins": 0, "locked_until": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return dbError(gorm.ErrRecordNotFound, "user")
+	}
+	return nil
+}
+
+// SetPassword replaces the password of a user. It also lifts a lockout,
+// since resetting the password proves ownership of the account.
+func (u *UserModel) SetPassword(id uuid.UUID, password string) error {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	result := u.DB.Model(&User{}).Where("id = ?", id).Updates(map[string]any{
+		"password":      hashedPassword,
+		"failed_logins": 0,
+		"locked_until":  nil,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return dbError(gorm.ErrRecordNotFound, "user")
+	}
+	return nil
+}
+
+// SetPendingEmail stores a new email address which becomes active once it has been confirmed.
+func (u *UserModel) SetPendingEmail(user *User, email string) error {
+	existing := new(User)
+	result := u.DB.Where("email = ?", email).Limit(1).Find(&existing)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return Errorf(ErrConflict, "email already exists")
+	}
+
+	user.PendingEmail = email
+	result = u.DB.Model(user).Update("pending_email", email)
+	return result.Error
+}
+
+// ConfirmEmail replaces the email address of a user with the pending one.
+func (u *UserModel) ConfirmEmail(id uuid.UUID) (*User, error) {
+	user, err := u.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.PendingEmail == "" {
+		return nil, Errorf(ErrValidation, "no email change pending")
+	}
+
+	user.Email = user.PendingEmail
+	user.PendingEmail = ""
+	result := u.DB.Model(user).Updates(map[string]any{"email": user.Email, "pending_email": ""})
+	if result.Error != nil {
+		return nil, dbError(result.Error, "email")
 	}
 	return user, nil
 }
 
+// SetDigestFrequency changes how often a user receives the digest email.
+func (u *UserModel) SetDigestFrequency(id uuid.UUID, frequency string) error {
+	valid := false
+	for _, f := range DigestFrequencies {
+		if f == frequency {
+			valid = true
+		}
+	}
+	if !valid {
+		return Errorf(ErrValidation, "invalid digest frequency")
+	}
+
+	result := u.DB.Model(&User{}).Where("id = ?", id).Update("digest_frequency", frequency)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return dbError(gorm.ErrRecordNotFound, "user")
+	}
+	return nil
+}
+
+// DueForDigest returns the activated users whose next digest is due at now.
+func (u *UserModel) DueForDigest(now time.Time) ([]User, error) {
+	var users []User
+	result := u.DB.Where("activated = ? AND ("+
+		"(digest_frequency = ? AND (last_digest_at IS NULL OR last_digest_at <= ?)) OR "+
+		"(digest_frequency = ? AND (last_digest_at IS NULL OR last_digest_at <= ?)))",
+		true,
+		DigestWeekly, DigestPeriod(DigestWeekly, now),
+		DigestMonthly, DigestPeriod(DigestMonthly, now),
+	).Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return users, nil
+}
+
+// ClaimDigest records that the digest due at now is sent to user. It
+// reports false if another instance has claimed the digest already, so
+// every digest is sent once.
+func (u *UserModel) ClaimDigest(user *User, now time.Time) (bool, error) {
+	result := u.DB.Model(&User{}).
+		Where("id = ? AND (last_digest_at IS NULL OR last_digest_at <= ?)", user.ID, DigestPeriod(user.DigestFrequency, now)).
+		Update("last_digest_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
 func (u *UserModel) Register(body *UserRegisterReq) (UserResponse, error) {
 	hashedPassword, err := hashPassword(body.Password)
 	if err != nil {
@@ -75,16 +334,26 @@ func (u *UserModel) Register(body *UserRegisterReq) (UserResponse, error) {
 	}
 	result := u.DB.Create(&user)
 	if result.Error != nil {
-		return UserResponse{}, result.Error
+		return UserResponse{}, dbError(result.Error, "email")
 	}
 
+	return user.Response(), nil
+}
+
+// OwnerID returns the id of the user, users own their account.
+func (u *User) OwnerID() uuid.UUID {
+	return u.ID
+}
+
+// Response returns the user without credentials and internal state.
+func (u *User) Response() UserResponse {
 	return UserResponse{
-		ID:        user.ID,
-		Name:      user.Name,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-	}, nil
+		ID:        u.ID,
+		Name:      u.Name,
+		Email:     u.Email,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	}
 }
 
 // Activate sets the activated flag to true for a user.
@@ -114,7 +383,7 @@ func (u *UserModel) GetByID(id uuid.UUID) (*User, error) {
 	user := new(User)
 	result := u.DB.First(&user, id)
 	if result.Error != nil {
-		return nil, result.Error
+		return nil, dbError(result.Error, "user")
 	}
 	return user, nil
 }
@@ -124,18 +393,47 @@ func (u *UserModel) GetByEmail(email string) (*User, error) {
 	user := new(User)
 	result := u.DB.Where("email = ?", email).First(&user)
 	if result.Error != nil {
-		return nil, result.Error
+		return nil, dbError(result.Error, "user")
+	}
+	return user, nil
+}
+
+// contextUserKey is the key of the authenticated user in the echo.Context.
+const contextUserKey = "user"
+
+// SetContextUser stores the authenticated user of a request. The auth
+// middleware sets it once per request.
+func SetContextUser(c echo.Context, user *User) {
+	c.Set(contextUserKey, user)
+}
+
+// ContextUser returns the authenticated user of a request.
+func ContextUser(c echo.Context) (*User, error) {
+	user, ok := c.Get(contextUserKey).(*User)
+	if !ok || user == nil {
+		return nil, ErrNoUser
 	}
 	return user, nil
 }
 
+// GetRole returns the role of the authenticated user of a request.
 func (u *UserModel) GetRole(c echo.Context) (string, error) {
-	user := c.Get("user").(*User)
+	user, err := ContextUser(c)
+	if err != nil {
+		return "", err
+	}
 	return user.Role, nil
 }
 
 // checkPasswordHash compares a plain text password with a hashed password
 // and returns true if they match or false otherwise.
+// dummyHash is checked against if there is no password to check, so that
+// unknown and locked accounts answer as slowly as wrong passwords.
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := hashPassword("not the password of any account")
+	return hash
+})
+
 func checkPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	if err != nil {
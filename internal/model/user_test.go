@@ -0,0 +1,62 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockoutAfter(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{MaxFailedLogins - 1, 0},
+		{MaxFailedLogins, lockoutBase},
+		{MaxFailedLogins + 1, 0},
+		{2 * MaxFailedLogins, 2 * lockoutBase},
+		{3 * MaxFailedLogins, 4 * lockoutBase},
+		{10 * MaxFailedLogins, lockoutMax},
+		{1000 * MaxFailedLogins, lockoutMax},
+	}
+	for _, tt := range tests {
+		if got := lockoutAfter(tt.failures); got != tt.want {
+			t.Errorf("lockoutAfter(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestUserIsLocked(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name        string
+		lockedUntil *time.Time
+		want        bool
+	}{
+		{"never locked", nil, false},
+		{"lock expired", &past, false},
+		{"locked", &future, true},
+	}
+	for _, tt := range tests {
+		user := &User{LockedUntil: tt.lockedUntil}
+		if got := user.IsLocked(); got != tt.want {
+			t.Errorf("%s: IsLocked() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCredentialsErrorIsInvalidCredentials(t *testing.T) {
+	until := time.Now()
+	for _, err := range []error{&CredentialsError{}, &CredentialsError{LockedUntil: &until}} {
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%#v is not ErrInvalidCredentials", err)
+		}
+		if err.Error() != ErrInvalidCredentials.Error() {
+			t.Errorf("%#v has message %q", err, err.Error())
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// Package qr renders QR codes as PNG or SVG images.
+package qr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/yeqown/go-qrcode/v2"
+	"github.com/yeqown/go-qrcode/writer/standard"
+	"golang.org/x/image/draw"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
+	MinSize   = 64
+	MaxSize   = 2048
+	MaxMargin = 16
+)
+
+// Options control how a QR code is rendered.
+type Options struct {
+	// Format is either FormatPNG or FormatSVG.
+	Format string
+	// Size is the approximate width and height of the image in pixels, the
+	// result is rounded down to a multiple of the module count.
+	Size int
+	// Margin is the width of the quiet zone around the code in modules.
+	Margin int
+	// Foreground and Background are hex colors, e.g. "000000" or "#ffffff".
+	Foreground string
+	Background string
+	// Level is the error correction level: L, M, Q or H.
+	Level string
+	// Logo is drawn in the center of the code, the error correction level is
+	// raised to H so the code stays readable.
+	Logo image.Image
+}
+
+// DefaultOptions returns the options used if nothing else is requested.
+func DefaultOptions() Options {
+	return Options{
+		Format:     FormatPNG,
+		Size:       256,
+		Margin:     4,
+		Foreground: "000000",
+		Background: "ffffff",
+		Level:      "M",
+	}
+}
+
+// Validate checks the options and normalizes the colors and the level.
+func (o *Options) Validate() error {
+	o.Format = strings.ToLower(o.Format)
+	if o.Format != FormatPNG && o.Format != FormatSVG {
+		return fmt.Errorf("format must be %q or %q", FormatPNG, FormatSVG)
+	}
+	if o.Size < MinSize || o.Size > MaxSize {
+		return fmt.Errorf("size must be between %d and %d", MinSize, MaxSize)
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("margin must be between 0 and %d", MaxMargin)
+	}
+
+	var err error
+	if o.Foreground, err = normalizeHex(o.Foreground); err != nil {
+		return fmt.Errorf("foreground: %w", err)
+	}
+	if o.Background, err = normalizeHex(o.Background); err != nil {
+		return fmt.Errorf("background: %w", err)
+	}
+
+	o.Level = strings.ToUpper(o.Level)
+	if _, err := ecLevel(o.Level); err != nil {
+		return err
+	}
+	if o.Logo != nil {
+		o.Level = "H"
+	}
+	return nil
+}
+
+// ContentType returns the MIME type of the rendered image.
+func (o Options) ContentType() string {
+	if o.Format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// Render writes the QR code for content to w. The options have to be validated.
+func Render(w io.Writer, content string, opts Options) error {
+	level, err := ecLevel(opts.Level)
+	if err != nil {
+		return err
+	}
+
+	qrc, err := qrcode.NewWith(content, level)
+	if err != nil {
+		return err
+	}
+
+	modules := qrc.Dimension() + 2*opts.Margin
+	moduleSize := opts.Size / modules
+	if moduleSize < 1 {
+		moduleSize = 1
+	}
+	// the image writer stores the module size in an uint8
+	if moduleSize > 255 {
+		moduleSize = 255
+	}
+
+	if opts.Format == FormatSVG {
+		return qrc.Save(&svgWriter{w: w, opts: opts, moduleSize: moduleSize})
+	}
+
+	fg, _ := parseHex(opts.Foreground)
+	bg, _ := parseHex(opts.Background)
+	imgOpts := []standard.ImageOption{
+		standard.WithBuiltinImageEncoder(standard.PNG_FORMAT),
+		standard.WithQRWidth(uint8(moduleSize)),
+		standard.WithBorderWidth(opts.Margin * moduleSize),
+		standard.WithFgColor(fg),
+		standard.WithBgColor(bg),
+	}
+	if opts.Logo != nil {
+		imgOpts = append(imgOpts, standard.WithLogoImage(scaleLogo(opts.Logo, modules*moduleSize/5)))
+	}
+
+	return qrc.Save(standard.NewWithWriter(nopWriteCloser{w}, imgOpts...))
+}
+
+// Matrix returns the modules of the QR code for content, true means dark.
+// It is used to print QR codes in a terminal.
+func Matrix(content string, level string) ([][]bool, error) {
+	ecl, err := ecLevel(strings.ToUpper(level))
+	if err != nil {
+		return nil, err
+	}
+
+	qrc, err := qrcode.NewWith(content, ecl)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &matrixWriter{}
+	if err := qrc.Save(m); err != nil {
+		return nil, err
+	}
+	return m.modules, nil
+}
+
+type matrixWriter struct {
+	modules [][]bool
+}
+
+func (m *matrixWriter) Write(mat qrcode.Matrix) error {
+	m.modules = make([][]bool, mat.Height())
+	for y := range m.modules {
+		m.modules[y] = make([]bool, mat.Width())
+	}
+	mat.Iterate(qrcode.IterDirection_ROW, func(x, y int, v qrcode.QRValue) {
+		m.modules[y][x] = v.IsSet()
+	})
+	return nil
+}
+
+func (m *matrixWriter) Close() error { return nil }
+
+// svgWriter renders a QR code matrix as SVG, one path for all dark modules.
+type svgWriter struct {
+	w          io.Writer
+	opts       Options
+	moduleSize int
+}
+
+func (s *svgWriter) Write(mat qrcode.Matrix) error {
+	size := (mat.Width() + 2*s.opts.Margin) * s.moduleSize
+
+	var path strings.Builder
+	mat.Iterate(qrcode.IterDirection_ROW, func(x, y int, v qrcode.QRValue) {
+		if !v.IsSet() {
+			return
+		}
+		fmt.Fprintf(&path, "M%d %dh%dv%dh-%dz",
+			(x+s.opts.Margin)*s.moduleSize, (y+s.opts.Margin)*s.moduleSize,
+			s.moduleSize, s.moduleSize, s.moduleSize)
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, size, size)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#%s"/>`, s.opts.Background)
+	fmt.Fprintf(&b, `<path fill="#%s" d="%s"/>`, s.opts.Foreground, path.String())
+
+	if s.opts.Logo != nil {
+		logoSize := size / 5
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, scaleLogo(s.opts.Logo, logoSize)); err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, `<image x="%d" y="%d" width="%d" height="%d" href="data:image/png;base64,%s"/>`,
+			(size-logoSize)/2, (size-logoSize)/2, logoSize, logoSize, base64.StdEncoding.EncodeToString(buf.Bytes()))
+	}
+	b.WriteString("</svg>\n")
+
+	_, err := io.WriteString(s.w, b.String())
+	return err
+}
+
+func (s *svgWriter) Close() error { return nil }
+
+// scaleLogo scales a logo to fit into a square of size pixels.
+func scaleLogo(logo image.Image, size int) image.Image {
+	if size < 1 {
+		size = 1
+	}
+	bounds := logo.Bounds()
+	w, h := size, size
+	if bounds.Dx() > bounds.Dy() {
+		h = size * bounds.Dy() / bounds.Dx()
+	} else if bounds.Dy() > bounds.Dx() {
+		w = size * bounds.Dx() / bounds.Dy()
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), logo, bounds, draw.Over, nil)
+	return dst
+}
+
+// ecLevel returns the encoding option for an error correction level.
+func ecLevel(level string) (qrcode.EncodeOption, error) {
+	switch level {
+	case "L":
+		return qrcode.WithErrorCorrectionLevel(qrcode.ErrorCorrectionLow), nil
+	case "M":
+		return qrcode.WithErrorCorrectionLevel(qrcode.ErrorCorrectionMedium), nil
+	case "Q":
+		return qrcode.WithErrorCorrectionLevel(qrcode.ErrorCorrectionQuart), nil
+	case "H":
+		return qrcode.WithErrorCorrectionLevel(qrcode.ErrorCorrectionHighest), nil
+	default:
+		return nil, fmt.Errorf("level must be one of L, M, Q or H")
+	}
+}
+
+func normalizeHex(hex string) (string, error) {
+	if _, err := parseHex(hex); err != nil {
+		return "", err
+	}
+	return strings.ToLower(strings.TrimPrefix(hex, "#")), nil
+}
+
+func parseHex(hex string) (color.RGBA, error) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expected 6 hex digits", hex)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expected 6 hex digits", hex)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,107 @@
+// Package ratelimit implements token bucket rate limiting with pluggable
+// storage for the buckets.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Policy describes a token bucket which holds up to Burst tokens and is
+// refilled with Rate tokens per second.
+type Policy struct {
+	Name  string
+	Rate  float64
+	Burst int
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next token is available, it is only
+	// set if the request was not allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the state of the buckets. Implementations must be safe for
+// concurrent use, a shared store (e.g. Redis) allows limits across instances.
+type Store interface {
+	Take(key string, policy Policy, now time.Time) (Result, error)
+}
+
+// idleTTL is how long an unused bucket is kept in a MemoryStore.
+const idleTTL = time.Hour
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryStore keeps buckets in memory. It is suitable for a single instance.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Take removes a token from the bucket identified by key.
+func (s *MemoryStore) Take(key string, policy Policy, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Burst), last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(policy.Burst), b.tokens+now.Sub(b.last).Seconds()*policy.Rate)
+	b.last = now
+
+	res := Result{Limit: policy.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration((1 - b.tokens) / policy.Rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = secondsToDuration((float64(policy.Burst) - b.tokens) / policy.Rate)
+
+	return res, nil
+}
+
+// sweep removes buckets which have not been used for idleTTL. Policies are
+// expected to refill within that time, so a removed bucket is
+// indistinguishable from a new one. It is called with the lock held.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	for key, b := range s.buckets {
+		if now.Sub(b.last) > idleTTL {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	if math.IsInf(seconds, 0) || math.IsNaN(seconds) {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
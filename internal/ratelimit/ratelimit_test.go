@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreBurst(t *testing.T) {
+	s := NewMemoryStore()
+	policy := Policy{Name: "test", Rate: 1, Burst: 3}
+	now := time.Now()
+
+	for want := 2; want >= 0; want-- {
+		res, err := s.Take("a", policy, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != want || res.Limit != 3 {
+			t.Fatalf("Take = %+v, want allowed with %d remaining", res, want)
+		}
+		if res.RetryAfter != 0 {
+			t.Errorf("RetryAfter = %v for an allowed request", res.RetryAfter)
+		}
+	}
+
+	res, _ := s.Take("a", policy, now)
+	if res.Allowed {
+		t.Fatal("Take allowed a request beyond the burst")
+	}
+	if res.RetryAfter != time.Second || res.Reset != 3*time.Second {
+		t.Errorf("RetryAfter = %v, Reset = %v, want 1s and 3s", res.RetryAfter, res.Reset)
+	}
+
+	// other keys have their own bucket
+	if res, _ := s.Take("b", policy, now); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("Take(b) = %+v, want a full bucket", res)
+	}
+}
+
+func TestMemoryStoreRefill(t *testing.T) {
+	s := NewMemoryStore()
+	policy := Policy{Name: "test", Rate: 2, Burst: 2}
+	now := time.Now()
+
+	s.Take("a", policy, now)
+	s.Take("a", policy, now)
+
+	now = now.Add(250 * time.Millisecond)
+	res, _ := s.Take("a", policy, now)
+	if res.Allowed || res.RetryAfter != 250*time.Millisecond {
+		t.Fatalf("Take after a quarter second = %+v, want denied for another 250ms", res)
+	}
+
+	now = now.Add(250 * time.Millisecond)
+	res, _ = s.Take("a", policy, now)
+	if !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("Take after half a second = %+v, want one refilled token", res)
+	}
+	if res.Reset != time.Second {
+		t.Errorf("Reset = %v, want 1s", res.Reset)
+	}
+
+	// the bucket doesn't fill beyond the burst
+	now = now.Add(time.Minute)
+	res, _ = s.Take("a", policy, now)
+	if !res.Allowed || res.Remaining != 1 {
+		t.Fatalf("Take after a minute = %+v, want a full bucket", res)
+	}
+	if res.Reset != 500*time.Millisecond {
+		t.Errorf("Reset = %v, want 500ms", res.Reset)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	s := NewMemoryStore()
+	policy := Policy{Name: "test", Rate: 1, Burst: 1}
+	now := time.Now()
+
+	s.Take("idle", policy, now)
+	now = now.Add(idleTTL / 2)
+	s.Take("active", policy, now)
+
+	now = now.Add(idleTTL/2 + time.Minute)
+	s.Take("active", policy, now)
+	if _, ok := s.buckets["idle"]; ok {
+		t.Error("idle bucket was not removed")
+	}
+	if _, ok := s.buckets["active"]; !ok {
+		t.Error("active bucket was removed")
+	}
+}
@@ -0,0 +1,270 @@
+// Package safety checks destination URLs before they are shortened.
+package safety
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidURL = errors.New("invalid url")
+	ErrScheme     = errors.New("url must use http or https")
+	ErrLoop       = errors.New("url points to a url shortener")
+	ErrBlocked    = errors.New("url is blocked")
+)
+
+// IsRejection reports whether err rejects a url, as opposed to a failure
+// to check it like an unreachable rule source.
+func IsRejection(err error) bool {
+	return errors.Is(err, ErrInvalidURL) || errors.Is(err, ErrScheme) || errors.Is(err, ErrLoop) || errors.Is(err, ErrBlocked)
+}
+
+// KnownShorteners are hosts of other url shorteners. Shortening their links
+// creates redirect chains which hide the final destination.
+var KnownShorteners = []string{
+	"bit.ly",
+	"buff.ly",
+	"cutt.ly",
+	"goo.gl",
+	"is.gd",
+	"ow.ly",
+	"rb.gy",
+	"rebrand.ly",
+	"s.id",
+	"shorturl.at",
+	"t.co",
+	"t.ly",
+	"tiny.cc",
+	"tinyurl.com",
+	"v.gd",
+}
+
+// Verdict is the result of a reputation check.
+type Verdict struct {
+	Unsafe bool
+	Reason string
+}
+
+// Checker rates the reputation of a destination. Implementations can be
+// backed by a local list or an external service.
+type Checker interface {
+	Check(ctx context.Context, u *url.URL) (Verdict, error)
+}
+
+// RuleSource provides the admin-managed allow- and blocklist of domains.
+type RuleSource interface {
+	Rules() (allow, block []string, err error)
+}
+
+// Validator validates destination urls.
+type Validator struct {
+	ownHosts   []string
+	shorteners []string
+	rules      RuleSource
+	checkers   []Checker
+}
+
+// NewValidator creates a validator. ownHosts are the hosts this instance is
+// reachable at, rules may be nil.
+func NewValidator(ownHosts []string, rules RuleSource, checkers ...Checker) *Validator {
+	return &Validator{
+		ownHosts:   normalizeAll(ownHosts),
+		shorteners: normalizeAll(KnownShorteners),
+		rules:      rules,
+		checkers:   checkers,
+	}
+}
+
+// Validate parses raw and checks that it is safe to redirect to. Domains on
+// the allowlist skip the block- and reputation checks, but never the checks
+// for scheme and redirect loops.
+func (v *Validator) Validate(ctx context.Context, raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, ErrScheme
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("%w: credentials in urls are not allowed", ErrInvalidURL)
+	}
+
+	host := normalize(u.Hostname())
+	if host == "" {
+		return nil, fmt.Errorf("%w: host is missing", ErrInvalidURL)
+	}
+	if isPrivateHost(host) {
+		return nil, fmt.Errorf("%w: private addresses are not allowed", ErrInvalidURL)
+	}
+	if matchesAny(host, v.ownHosts) || matchesAny(host, v.shorteners) {
+		return nil, ErrLoop
+	}
+
+	if v.rules != nil {
+		allow, block, err := v.rules.Rules()
+		if err != nil {
+			return nil, err
+		}
+		if matchesAny(host, normalizeAll(allow)) {
+			return u, nil
+		}
+		if matchesAny(host, normalizeAll(block)) {
+			return nil, fmt.Errorf("%w: %s is on the blocklist", ErrBlocked, host)
+		}
+	}
+
+	for _, checker := range v.checkers {
+		verdict, err := checker.Check(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		if verdict.Unsafe {
+			return nil, fmt.Errorf("%w: %s", ErrBlocked, verdict.Reason)
+		}
+	}
+
+	return u, nil
+}
+
+// ListChecker is a Checker backed by a static list of domains.
+type ListChecker struct {
+	domains []string
+	reason  string
+}
+
+func NewListChecker(domains []string, reason string) *ListChecker {
+	return &ListChecker{
+		domains: normalizeAll(domains),
+		reason:  reason,
+	}
+}
+
+func (l *ListChecker) Check(_ context.Context, u *url.URL) (Verdict, error) {
+	host := normalize(u.Hostname())
+	if matchesAny(host, l.domains) {
+		return Verdict{Unsafe: true, Reason: host + " " + l.reason}, nil
+	}
+	return Verdict{}, nil
+}
+
+// LoadList reads a list of domains from a file, one per line. Empty lines
+// and lines starting with # are ignored.
+func LoadList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var domains []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	return domains, scanner.Err()
+}
+
+// matchesAny reports whether host is one of domains or a subdomain of one.
+func matchesAny(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrivateHost reports whether host is a local name or an address which
+// isn't publicly routable. Hosts which look like an IPv4 address in any
+// form browsers accept, like 2130706433 or 0x7f.1, count as addresses.
+func isPrivateHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		if !looksNumeric(host) {
+			return false
+		}
+		var ok bool
+		addr, ok = parseIPv4(host)
+		if !ok {
+			// not a valid address, but not a valid host name either
+			return true
+		}
+	}
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsUnspecified() ||
+		addr.IsMulticast() || thisNetwork.Contains(addr) || sharedAddressSpace.Contains(addr)
+}
+
+var (
+	// thisNetwork is 0.0.0.0/8, which reaches the local host on Linux.
+	thisNetwork = netip.MustParsePrefix("0.0.0.0/8")
+	// sharedAddressSpace is 100.64.0.0/10, used for carrier-grade NAT.
+	sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+)
+
+// looksNumeric reports whether the last label of host starts like a
+// number. Top level domains never do, so such hosts are meant as addresses.
+func looksNumeric(host string) bool {
+	last := host[strings.LastIndex(host, ".")+1:]
+	return last != "" && last[0] >= '0' && last[0] <= '9'
+}
+
+// parseIPv4 parses the IPv4 notations of inet_aton: one to four parts in
+// decimal, octal with a leading 0 or hex with a leading 0x, the last part
+// filling the remaining bytes.
+func parseIPv4(host string) (netip.Addr, bool) {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return netip.Addr{}, false
+	}
+
+	var ip uint64
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 0, 32)
+		if err != nil || part == "" || strings.Contains(part, "_") {
+			return netip.Addr{}, false
+		}
+		if i < len(parts)-1 {
+			if n > 0xff {
+				return netip.Addr{}, false
+			}
+			ip = ip<<8 | n
+			continue
+		}
+		bits := 8 * (4 - i)
+		if n >= 1<<bits {
+			return netip.Addr{}, false
+		}
+		ip = ip<<bits | n
+	}
+	return netip.AddrFrom4([4]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)}), true
+}
+
+func normalize(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+func normalizeAll(hosts []string) []string {
+	normalized := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if h := normalize(host); h != "" {
+			normalized = append(normalized, h)
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Blob is a file stored in the database.
+type Blob struct {
+	Key         string `gorm:"type:varchar(255);primary_key"`
+	ContentType string `gorm:"type:varchar(255)"`
+	Data        []byte `gorm:"not null"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Database stores files in the blobs table. They are served by the API
+// server below urlPrefix.
+type Database struct {
+	db        *gorm.DB
+	urlPrefix string
+}
+
+func NewDatabase(db *gorm.DB, urlPrefix string) *Database {
+	return &Database{
+		db:        db,
+		urlPrefix: urlPrefix,
+	}
+}
+
+func (d *Database) Put(ctx context.Context, key, contentType string, r io.Reader) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	blob := &Blob{
+		Key:         key,
+		ContentType: contentType,
+		Data:        data,
+	}
+	result := d.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(blob)
+	if result.Error != nil {
+		return "", result.Error
+	}
+
+	return d.urlPrefix + "/" + key, nil
+}
+
+func (d *Database) Open(ctx context.Context, key string) (*Object, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	blob := new(Blob)
+	result := d.db.WithContext(ctx).Where("key = ?", key).First(&blob)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, result.Error
+	}
+
+	return &Object{
+		Body:        nopCloser{bytes.NewReader(blob.Data)},
+		ContentType: blob.ContentType,
+		ModTime:     blob.UpdatedAt,
+	}, nil
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// Local stores files in a directory on the local disk. They are served by
+// the API server below urlPrefix.
+type Local struct {
+	dir       string
+	urlPrefix string
+}
+
+// NewLocal creates a local storage in dir, the directory is created if it
+// doesn't exist yet.
+func NewLocal(dir, urlPrefix string) (*Local, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Local{
+		dir:       dir,
+		urlPrefix: urlPrefix,
+	}, nil
+}
+
+func (l *Local) Put(_ context.Context, key, _ string, r io.Reader) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+
+	// write to a temporary file first so readers never see partial files
+	f, err := os.CreateTemp(l.dir, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close() // ignore error; Copy error takes precedence
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(f.Name(), filepath.Join(l.dir, key)); err != nil {
+		return "", err
+	}
+
+	return l.urlPrefix + "/" + key, nil
+}
+
+func (l *Local) Open(_ context.Context, key string) (*Object, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(l.dir, key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &Object{
+		Body:        f,
+		ContentType: mime.TypeByExtension(filepath.Ext(key)),
+		ModTime:     info.ModTime(),
+	}, nil
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3 stores files in an AWS S3 bucket, they are served by S3 directly.
+type S3 struct {
+	uploader *s3manager.Uploader
+	bucket   string
+}
+
+// NewS3 creates a S3 storage. The credentials are read from the environment.
+func NewS3(region, bucket string) (*S3, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(region),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3{
+		uploader: s3manager.NewUploader(sess),
+		bucket:   bucket,
+	}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key, contentType string, r io.Reader) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+
+	result, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        r,
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file, %v", err)
+	}
+	return result.Location, nil
+}
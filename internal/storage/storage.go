@@ -0,0 +1,43 @@
+// Package storage stores blobs such as QR code images. Files are kept in S3,
+// on the local disk or in the database, depending on the configuration.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("file not found")
+	ErrInvalidKey = errors.New("invalid key")
+)
+
+// Storage stores files under a key and returns the url they can be fetched from.
+type Storage interface {
+	Put(ctx context.Context, key, contentType string, r io.Reader) (string, error)
+}
+
+// Object is a stored file opened for reading, the caller has to close Body.
+type Object struct {
+	Body        io.ReadSeekCloser
+	ContentType string
+	ModTime     time.Time
+}
+
+// Opener is implemented by storages whose files are served by the API
+// server itself instead of an external service.
+type Opener interface {
+	Open(ctx context.Context, key string) (*Object, error)
+}
+
+// validateKey rejects keys which would escape the storage, e.g. "../etc/passwd".
+func validateKey(key string) error {
+	if key == "" || strings.ContainsAny(key, `/\`) || path.Clean(key) != key || key == "." || key == ".." {
+		return ErrInvalidKey
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package shrink
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Error codes of the device authorization flow, see RFC 8628.
+const (
+	ErrCodeAuthorizationPending = "authorization_pending"
+	ErrCodeSlowDown             = "slow_down"
+	ErrCodeAccessDenied         = "access_denied"
+	ErrCodeExpiredToken         = "expired_token"
+)
+
+type LoginResponse struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+	Token string    `json:"token"`
+}
+
+type User struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Login exchanges email and password for a token. Set it as Client.Token
+// to authenticate further requests.
+func (c *Client) Login(ctx context.Context, email, password string) (*LoginResponse, error) {
+	req := map[string]string{"email": email, "password": password}
+	login := new(LoginResponse)
+	err := c.Do(ctx, http.MethodPost, apiPath+"/login", req, login)
+	if err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+// GetUser returns a user.
+func (c *Client) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	user := new(User)
+	err := c.Do(ctx, http.MethodGet, apiPath+"/users/"+id.String(), nil, user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// DeviceCode starts a device authorization flow.
+type DeviceCode struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// RequestDeviceCode starts a device authorization flow. The user approves
+// the UserCode in the browser, meanwhile PollDeviceToken or WaitForDeviceToken
+// waits for the token.
+func (c *Client) RequestDeviceCode(ctx context.Context) (*DeviceCode, error) {
+	code := new(DeviceCode)
+	err := c.Do(ctx, http.MethodPost, apiPath+"/device/code", nil, code)
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// PollDeviceToken asks once for the token of a device code. While the flow
+// has not completed, it returns an *APIError with one of the ErrCode codes.
+func (c *Client) PollDeviceToken(ctx context.Context, deviceCode string) (*LoginResponse, error) {
+	login := new(LoginResponse)
+	err := c.Do(ctx, http.MethodPost, apiPath+"/device/token", map[string]string{"device_code": deviceCode}, login)
+	if err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+// WaitForDeviceToken polls for the token of a device code until the user
+// approved or denied it, or the code expired.
+func (c *Client) WaitForDeviceToken(ctx context.Context, code *DeviceCode) (*LoginResponse, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(code.ExpiresIn)*time.Second)
+	defer cancel()
+
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		login, err := c.PollDeviceToken(ctx, code.DeviceCode)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			return login, err
+		}
+		switch apiErr.Code {
+		case ErrCodeAuthorizationPending:
+		case ErrCodeSlowDown:
+			interval += 5 * time.Second
+		default:
+			return nil, err
+		}
+	}
+}
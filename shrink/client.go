@@ -0,0 +1,274 @@
+// Package shrink is a client for the Shrinkster API.
+//
+//	client := shrink.NewClient("https://shrink.ch")
+//	login, err := client.Login(ctx, "me@example.com", "secret")
+//	if err != nil {
+//		return err
+//	}
+//	client.Token = login.Token
+//	created, err := client.CreateURL(ctx, shrink.CreateURLRequest{Original: "https://example.com"})
+//
+// Failed requests return an *APIError. Requests which failed temporarily
+// are retried with exponential backoff.
+package shrink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultHost      = "https://shrink.ch"
+	DefaultUserAgent = "Shrinkster Go Client"
+	// apiPath is the prefix of the versioned API the client talks to.
+	apiPath = "/api/v1"
+	// maxRetryWait is the longest Retry-After the client waits for, a
+	// longer one is returned as error right away.
+	maxRetryWait = time.Minute
+)
+
+type Client struct {
+	HttpClient http.Client
+	Token      string
+	Host       string
+	UserAgent  string
+	// MaxRetries is the number of times a request is retried after a
+	// network error, a 429 or a 502, 503 and 504 response.
+	MaxRetries int
+	// RetryBaseDelay is the delay before the first retry, it doubles with every retry.
+	RetryBaseDelay time.Duration
+}
+
+// NewClient returns a client for the Shrinkster server at host, or
+// shrink.ch if host is empty.
+func NewClient(host string) *Client {
+	if host == "" {
+		host = DefaultHost
+	}
+	return &Client{
+		HttpClient: http.Client{
+			Timeout: 10 * time.Second,
+		},
+		Host:           strings.TrimSuffix(host, "/"),
+		UserAgent:      DefaultUserAgent,
+		MaxRetries:     3,
+		RetryBaseDelay: 200 * time.Millisecond,
+	}
+}
+
+// Do sends a request to the API. in is encoded as the JSON body unless it
+// is nil, the response is decoded into out unless it is nil. Errors
+// returned by the API are of type *APIError.
+func (c *Client) Do(ctx context.Context, method, path string, in, out any) error {
+	res, err := c.send(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	return decode(res, out)
+}
+
+// send sends a request with retries and returns the response if it was
+// successful. The caller has to close the response body.
+func (c *Client) send(ctx context.Context, method, path string, in any) (*http.Response, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := c.sendOnce(ctx, method, path, body)
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil || !idempotent(method) {
+				return nil, err
+			}
+		case res.StatusCode < 400:
+			return res, nil
+		default:
+			apiErr := newAPIError(res)
+			res.Body.Close()
+			if !retryable(method, res.StatusCode) {
+				return nil, apiErr
+			}
+			err = apiErr
+			wait = apiErr.RetryAfter
+		}
+
+		if attempt >= c.MaxRetries || wait > maxRetryWait {
+			return nil, err
+		}
+		if wait == 0 {
+			wait = c.backoff(attempt)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) sendOnce(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.Host+path, r)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	return c.HttpClient.Do(req)
+}
+
+// backoff returns the delay before the next attempt, with jitter so that
+// many clients don't retry at the same time.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.RetryBaseDelay << attempt
+	if d <= 0 || d > 30*time.Second {
+		d = 30 * time.Second
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// idempotent reports whether a request can be repeated without side effects.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryable reports whether a failed request should be repeated. A 429 means
+// the request wasn't processed, so it is safe to repeat for any method.
+func retryable(method string, status int) bool {
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(method)
+	}
+	return false
+}
+
+// APIError is an error response of the Shrinkster API.
+type APIError struct {
+	StatusCode int
+	// Code is a machine readable error code, if the server sent one.
+	Code    string
+	Message string
+	// RetryAfter is set if the server asked to wait before trying again.
+	RetryAfter time.Duration
+	// Existing is the link the user already has, if they shortened the
+	// same url again.
+	Existing *CreatedURL
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("shrink: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("shrink: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// newAPIError reads the error from a response. The API sends either a JSON
+// string or an object with an error code.
+func newAPIError(res *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: res.StatusCode}
+	if s := res.Header.Get("Retry-After"); s != "" {
+		if seconds, err := strconv.Atoi(s); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if err != nil || len(body) == 0 {
+		return apiErr
+	}
+
+	var msg string
+	if json.Unmarshal(body, &msg) == nil {
+		apiErr.Message = msg
+		return apiErr
+	}
+
+	var obj struct {
+		Error            json.RawMessage `json:"error"`
+		ErrorDescription string          `json:"error_description"`
+		Message          string          `json:"message"`
+	}
+	if json.Unmarshal(body, &obj) == nil {
+		var nested struct {
+			Code     string      `json:"code"`
+			Message  string      `json:"message"`
+			Existing *CreatedURL `json:"existing"`
+		}
+		if json.Unmarshal(obj.Error, &apiErr.Code) != nil && json.Unmarshal(obj.Error, &nested) == nil {
+			apiErr.Code = nested.Code
+			apiErr.Message = nested.Message
+			apiErr.Existing = nested.Existing
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = obj.ErrorDescription
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = obj.Message
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = apiErr.Code
+		}
+	}
+	return apiErr
+}
+
+// StatusCode returns the HTTP status code of an *APIError, or 0 for other errors.
+func StatusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is an API error with status 404.
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsUnauthorized reports whether err is an API error with status 401 or 403.
+func IsUnauthorized(err error) bool {
+	status := StatusCode(err)
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
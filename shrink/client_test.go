@@ -0,0 +1,258 @@
+package shrink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// newTestClient returns a client for srv which retries without noticeable delays.
+func newTestClient(srv *httptest.Server) *Client {
+	c := NewClient(srv.URL)
+	c.RetryBaseDelay = time.Millisecond
+	return c
+}
+
+// failingServer answers the first failures requests with status and then
+// with an empty json object.
+func failingServer(t *testing.T, failures int, status int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(calls.Add(1)) <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			fmt.Fprint(w, `"try again"`)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		failures  int
+		status    int
+		wantCalls int32
+		wantErr   int
+	}{
+		{"get retries 503", http.MethodGet, 2, http.StatusServiceUnavailable, 3, 0},
+		{"get retries 502", http.MethodGet, 1, http.StatusBadGateway, 2, 0},
+		{"get gives up", http.MethodGet, 10, http.StatusGatewayTimeout, 4, http.StatusGatewayTimeout},
+		{"post doesn't retry 503", http.MethodPost, 1, http.StatusServiceUnavailable, 1, http.StatusServiceUnavailable},
+		{"post retries 429", http.MethodPost, 1, http.StatusTooManyRequests, 2, 0},
+		{"client errors aren't retried", http.MethodGet, 1, http.StatusBadRequest, 1, http.StatusBadRequest},
+		{"server errors aren't retried", http.MethodGet, 1, http.StatusInternalServerError, 1, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		srv, calls := failingServer(t, tt.failures, tt.status, nil)
+		err := newTestClient(srv).Do(context.Background(), tt.method, "/", nil, &struct{}{})
+		if got := calls.Load(); got != tt.wantCalls {
+			t.Errorf("%s: %d calls, want %d", tt.name, got, tt.wantCalls)
+		}
+		if StatusCode(err) != tt.wantErr || (tt.wantErr == 0) != (err == nil) {
+			t.Errorf("%s: err = %v, want status %d", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	header := http.Header{"Retry-After": {"1"}}
+	srv, calls := failingServer(t, 1, http.StatusTooManyRequests, header)
+	start := time.Now()
+	err := newTestClient(srv).Do(context.Background(), http.MethodGet, "/", nil, nil)
+	if err != nil || calls.Load() != 2 {
+		t.Fatalf("err = %v after %d calls, want success after 2", err, calls.Load())
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least the Retry-After of 1s", elapsed)
+	}
+
+	// waits longer than maxRetryWait are returned right away
+	header = http.Header{"Retry-After": {"3600"}}
+	srv, calls = failingServer(t, 1, http.StatusTooManyRequests, header)
+	err = newTestClient(srv).Do(context.Background(), http.MethodGet, "/", nil, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter != time.Hour || calls.Load() != 1 {
+		t.Errorf("err = %v after %d calls, want a 429 with RetryAfter 1h after 1", err, calls.Load())
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	header := http.Header{"Retry-After": {"30"}}
+	srv, _ := failingServer(t, 1, http.StatusTooManyRequests, header)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := newTestClient(srv).Do(ctx, http.MethodGet, "/", nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the context error", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := &Client{RetryBaseDelay: 100 * time.Millisecond}
+	for attempt := 0; attempt < 12; attempt++ {
+		max := c.RetryBaseDelay << attempt
+		if max > 30*time.Second {
+			max = 30 * time.Second
+		}
+		for i := 0; i < 20; i++ {
+			if d := c.backoff(attempt); d < max/2 || d > max {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", attempt, d, max/2, max)
+			}
+		}
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	existingID := uuid.New()
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   APIError
+	}{
+		{"bare message", http.StatusNotFound, `"Not Found"`,
+			APIError{Message: "Not Found"}},
+		{"envelope", http.StatusBadRequest, `{"error":{"code":"bad_request","message":"original: is required"}}`,
+			APIError{Code: "bad_request", Message: "original: is required"}},
+		{"envelope with existing link", http.StatusConflict,
+			`{"error":{"code":"conflict","message":"already shortened","existing":{"id":"` + existingID.String() + `","full_url":"https://shrink.ch/s/abc"}}}`,
+			APIError{Code: "conflict", Message: "already shortened", Existing: &CreatedURL{ID: existingID, FullURL: "https://shrink.ch/s/abc"}}},
+		{"oauth error", http.StatusBadRequest, `{"error":"authorization_pending","error_description":"waiting for approval"}`,
+			APIError{Code: "authorization_pending", Message: "waiting for approval"}},
+		{"oauth error without description", http.StatusBadRequest, `{"error":"slow_down"}`,
+			APIError{Code: "slow_down", Message: "slow_down"}},
+		{"echo error", http.StatusMethodNotAllowed, `{"message":"Method Not Allowed"}`,
+			APIError{Message: "Method Not Allowed"}},
+		{"empty body", http.StatusUnauthorized, ``, APIError{}},
+		{"html body", http.StatusBadGateway, `<html>bad gateway</html>`, APIError{}},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			fmt.Fprint(w, tt.body)
+		}))
+		c := newTestClient(srv)
+		c.MaxRetries = 0
+		err := c.Do(context.Background(), http.MethodPost, "/", nil, nil)
+		srv.Close()
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s: err = %v, want an *APIError", tt.name, err)
+			continue
+		}
+		tt.want.StatusCode = tt.status
+		if apiErr.StatusCode != tt.want.StatusCode || apiErr.Code != tt.want.Code || apiErr.Message != tt.want.Message {
+			t.Errorf("%s: got %+v, want %+v", tt.name, apiErr, tt.want)
+		}
+		if (apiErr.Existing == nil) != (tt.want.Existing == nil) ||
+			(apiErr.Existing != nil && *apiErr.Existing != *tt.want.Existing) {
+			t.Errorf("%s: Existing = %+v, want %+v", tt.name, apiErr.Existing, tt.want.Existing)
+		}
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 42`)
+	}))
+	defer srv.Close()
+
+	_, err := newTestClient(srv).GetURL(context.Background(), "abc")
+	var apiErr *APIError
+	if err == nil || errors.As(err, &apiErr) {
+		t.Errorf("err = %v, want a decoding error", err)
+	}
+}
+
+// pagingServer serves total links in pages like the API does.
+func pagingServer(t *testing.T, total int, failPage int) (*httptest.Server, []URL, *atomic.Int32) {
+	urls := make([]URL, total)
+	for i := range urls {
+		urls[i] = URL{ID: uuid.New(), ShortCode: strconv.Itoa(i)}
+	}
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+		if r.URL.Path != apiPath+"/me/urls" || page < 1 || size < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if page == failPage {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `"Forbidden"`)
+			return
+		}
+
+		start := min((page-1)*size, total)
+		end := min(start+size, total)
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		json.NewEncoder(w).Encode(urls[start:end])
+	}))
+	t.Cleanup(srv.Close)
+	return srv, urls, &calls
+}
+
+func TestURLIterator(t *testing.T) {
+	for _, total := range []int{0, 1, 4, 5} {
+		srv, urls, calls := pagingServer(t, total, 0)
+		it := newTestClient(srv).MyURLs(context.Background(), 2)
+
+		var got []URL
+		for it.Next() {
+			got = append(got, it.URL())
+		}
+		if err := it.Err(); err != nil {
+			t.Fatalf("%d links: %v", total, err)
+		}
+		if len(got) != total {
+			t.Fatalf("%d links: iterated over %d", total, len(got))
+		}
+		for i := range got {
+			if got[i].ID != urls[i].ID {
+				t.Errorf("%d links: link %d is %s, want %s", total, i, got[i].ShortCode, urls[i].ShortCode)
+			}
+		}
+		if want := max(1, (total+1)/2); int(calls.Load()) != want {
+			t.Errorf("%d links: %d requests, want %d", total, calls.Load(), want)
+		}
+		if it.Next() {
+			t.Errorf("%d links: Next is true after the end", total)
+		}
+	}
+}
+
+func TestURLIteratorError(t *testing.T) {
+	srv, _, calls := pagingServer(t, 5, 2)
+	it := newTestClient(srv).MyURLs(context.Background(), 2)
+
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if n != 2 || StatusCode(it.Err()) != http.StatusForbidden {
+		t.Errorf("iterated over %d links with err %v, want 2 and a 403", n, it.Err())
+	}
+	if it.Next() || calls.Load() != 2 {
+		t.Errorf("Next continued after an error, %d requests", calls.Load())
+	}
+}
@@ -0,0 +1,24 @@
+package shrink
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+func decode(res *http.Response, out any) error {
+	err := json.NewDecoder(res.Body).Decode(out)
+	if err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+func readAll(res *http.Response) ([]byte, error) {
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,326 @@
+package shrink
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// URL is a short link.
+type URL struct {
+	ID        uuid.UUID  `json:"id"`
+	Original  string     `json:"original"`
+	ShortCode string     `json:"short_url"`
+	Visits    int        `json:"visits"`
+	QRCodeURL string     `json:"qr_code_url,omitempty"`
+	Disabled  bool       `json:"disabled"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// URLInfo are the details of a short link.
+type URLInfo struct {
+	URL
+	FullURL        string       `json:"full_url"`
+	DisabledReason string       `json:"disabled_reason,omitempty"`
+	Clicks         ClickSummary `json:"clicks"`
+}
+
+// ClickSummary is the number of recent visits of a short link.
+type ClickSummary struct {
+	Last24h     int        `json:"last_24h"`
+	Last7d      int        `json:"last_7d"`
+	Last30d     int        `json:"last_30d"`
+	LastClickAt *time.Time `json:"last_click_at,omitempty"`
+}
+
+// GetURL returns the details of a short link of the logged in user by its code.
+func (c *Client) GetURL(ctx context.Context, code string) (*URLInfo, error) {
+	info := new(URLInfo)
+	err := c.Do(ctx, http.MethodGet, apiPath+"/urls/"+url.PathEscape(code), nil, info)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// StatsOptions select the period and interval of URLStats, zero values
+// use the server defaults: the last 30 days per day.
+type StatsOptions struct {
+	Since time.Time
+	Until time.Time
+	// Interval is hour, day, week or month.
+	Interval string
+}
+
+// ClickStats are the visits of a short link in a period.
+type ClickStats struct {
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	Interval  string        `json:"interval"`
+	Total     int           `json:"total"`
+	Series    []ClickBucket `json:"series"`
+	Referrers []ClickCount  `json:"referrers"`
+	Countries []ClickCount  `json:"countries"`
+	Devices   []ClickCount  `json:"devices"`
+}
+
+// ClickBucket is the number of visits in the interval starting at Start.
+type ClickBucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int       `json:"clicks"`
+}
+
+// ClickCount is the number of visits from a referrer, country or device.
+type ClickCount struct {
+	Name   string `json:"name"`
+	Clicks int    `json:"clicks"`
+}
+
+// URLStats returns the visits of a short link over time and its top
+// referrers, countries and devices.
+func (c *Client) URLStats(ctx context.Context, code string, opts StatsOptions) (*ClickStats, error) {
+	query := url.Values{}
+	if !opts.Since.IsZero() {
+		query.Set("since", opts.Since.Format(time.RFC3339))
+	}
+	if !opts.Until.IsZero() {
+		query.Set("until", opts.Until.Format(time.RFC3339))
+	}
+	if opts.Interval != "" {
+		query.Set("interval", opts.Interval)
+	}
+
+	stats := new(ClickStats)
+	err := c.Do(ctx, http.MethodGet, apiPath+"/urls/"+url.PathEscape(code)+"/stats?"+query.Encode(), nil, stats)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+type CreateURLRequest struct {
+	Original string `json:"original"`
+	// ShortCode is optional, a random code is generated if it is empty.
+	ShortCode string     `json:"short_code,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type CreatedURL struct {
+	ID        uuid.UUID `json:"id"`
+	FullURL   string    `json:"full_url"`
+	QRCodeURL string    `json:"qr_code_url,omitempty"`
+}
+
+// CreateURL creates a short link.
+func (c *Client) CreateURL(ctx context.Context, req CreateURLRequest) (*CreatedURL, error) {
+	created := new(CreatedURL)
+	err := c.Do(ctx, http.MethodPost, apiPath+"/urls", req, created)
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// CreateURLFor creates a short link owned by another user. It requires the
+// admin role.
+func (c *Client) CreateURLFor(ctx context.Context, userID uuid.UUID, req CreateURLRequest) (*CreatedURL, error) {
+	created := new(CreatedURL)
+	err := c.Do(ctx, http.MethodPost, apiPath+"/users/"+userID.String()+"/urls", req, created)
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateURLRequest replaces the destination and expiry of a short link.
+// Without ExpiresAt the link doesn't expire.
+type UpdateURLRequest struct {
+	Original  string     `json:"original"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// UpdateURL changes the destination and expiry of a short link.
+func (c *Client) UpdateURL(ctx context.Context, id uuid.UUID, req UpdateURLRequest) (*CreatedURL, error) {
+	updated := new(CreatedURL)
+	err := c.Do(ctx, http.MethodPut, apiPath+"/urls/"+id.String(), req, updated)
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteURL deletes a short link.
+func (c *Client) DeleteURL(ctx context.Context, id uuid.UUID) error {
+	return c.Do(ctx, http.MethodDelete, apiPath+"/urls/"+id.String(), nil, nil)
+}
+
+// URLPage is a page of short links.
+type URLPage struct {
+	URLs []URL
+	// Total is the number of links on all pages.
+	Total int
+	// Next is the number of the next page, or 0 on the last page.
+	Next int
+}
+
+// ListURLs returns a page of the links of a user. Pages start at 1. Only
+// admins may list the links of other users, see ListMyURLs.
+func (c *Client) ListURLs(ctx context.Context, userID uuid.UUID, page, pageSize int) (*URLPage, error) {
+	return c.listURLs(ctx, apiPath+"/users/"+userID.String()+"/urls", page, pageSize)
+}
+
+// ListMyURLs returns a page of the links of the authenticated user. Pages start at 1.
+func (c *Client) ListMyURLs(ctx context.Context, page, pageSize int) (*URLPage, error) {
+	return c.listURLs(ctx, apiPath+"/me/urls", page, pageSize)
+}
+
+func (c *Client) listURLs(ctx context.Context, path string, page, pageSize int) (*URLPage, error) {
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+	query.Set("page_size", strconv.Itoa(pageSize))
+
+	res, err := c.send(ctx, http.MethodGet, path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	p := new(URLPage)
+	err = decode(res, &p.URLs)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Total, _ = strconv.Atoi(res.Header.Get("X-Total-Count"))
+	if page*pageSize < p.Total {
+		p.Next = page + 1
+	}
+	return p, nil
+}
+
+// URLs returns an iterator over all links of a user, fetching pageSize links at a time.
+//
+//	it := client.URLs(ctx, userID, 100)
+//	for it.Next() {
+//		fmt.Println(it.URL().ShortCode)
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+func (c *Client) URLs(ctx context.Context, userID uuid.UUID, pageSize int) *URLIterator {
+	return c.newURLIterator(ctx, apiPath+"/users/"+userID.String()+"/urls", pageSize)
+}
+
+// MyURLs returns an iterator over all links of the authenticated user, see URLs.
+func (c *Client) MyURLs(ctx context.Context, pageSize int) *URLIterator {
+	return c.newURLIterator(ctx, apiPath+"/me/urls", pageSize)
+}
+
+func (c *Client) newURLIterator(ctx context.Context, path string, pageSize int) *URLIterator {
+	return &URLIterator{
+		ctx:      ctx,
+		client:   c,
+		path:     path,
+		pageSize: pageSize,
+		next:     1,
+		index:    -1,
+	}
+}
+
+// URLIterator iterates over the links of a user, see Client.URLs and Client.MyURLs.
+type URLIterator struct {
+	ctx      context.Context
+	client   *Client
+	path     string
+	pageSize int
+
+	page  []URL
+	index int
+	next  int
+	err   error
+}
+
+// Next advances to the next link. It returns false when there are no more
+// links or an error occurred.
+func (it *URLIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.index++
+	for it.index >= len(it.page) {
+		if it.next == 0 {
+			return false
+		}
+
+		p, err := it.client.listURLs(it.ctx, it.path, it.next, it.pageSize)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.index, it.next = p.URLs, 0, p.Next
+	}
+	return true
+}
+
+// URL returns the current link.
+func (it *URLIterator) URL() URL {
+	return it.page[it.index]
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *URLIterator) Err() error {
+	return it.err
+}
+
+// QROptions style a QR code, zero values use the server defaults.
+type QROptions struct {
+	// Format is png or svg.
+	Format     string
+	Size       int
+	Margin     int
+	Foreground string
+	Background string
+	Level      string
+	Logo       bool
+}
+
+// QRCode returns the image of the QR code of a short link.
+func (c *Client) QRCode(ctx context.Context, code string, opts QROptions) ([]byte, error) {
+	query := url.Values{}
+	if opts.Format != "" {
+		query.Set("format", opts.Format)
+	}
+	if opts.Size != 0 {
+		query.Set("size", strconv.Itoa(opts.Size))
+	}
+	if opts.Margin != 0 {
+		query.Set("margin", strconv.Itoa(opts.Margin))
+	}
+	if opts.Foreground != "" {
+		query.Set("fg", opts.Foreground)
+	}
+	if opts.Background != "" {
+		query.Set("bg", opts.Background)
+	}
+	if opts.Level != "" {
+		query.Set("level", opts.Level)
+	}
+	if opts.Logo {
+		query.Set("logo", "true")
+	}
+
+	res, err := c.send(ctx, http.MethodGet, "/s/"+url.PathEscape(code)+"/qr?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return readAll(res)
+}